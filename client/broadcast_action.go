@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// BroadcastAction is sent by the server after it has performed an operation.
+// When the server has performed the actions for a SwapDevice we sent, action_name is "effect_result".
+// When a device loses (or gets back) its connection to the server, action_name is "driver_disconnected" (or
+// "driver_connected").
+type BroadcastAction struct {
+	ActionName string          `json:"action_name"`
+	Value      json.RawMessage `json:"value,omitempty"`
+}
+
+// EffectResult is what happened to the actions the server performed for us.
+type EffectResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DriverEvent is sent when one of the server's drivers loses, or gets back, the connection to its device.
+type DriverEvent struct {
+	Driver string `json:"driver"`
+	State  string `json:"state"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Unmarshal reads in a BroadcastAction, making sure that it has an action name.
+func (ba *BroadcastAction) Unmarshal(data []byte) error {
+	if err := json.Unmarshal(data, ba); err != nil {
+		return err
+	}
+	if ba.ActionName == "" {
+		return errors.New("required field is missing")
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ var outgoingChanges = make(chan string)
 
 var addr = flag.String("addr", "127.0.0.1:8787", "http service address")
 var deviceName = flag.String("name", "home-computer", "the name of the device in the layout")
+var cornerSize = flag.Int("corner", 0, "size (in pixels) of the corner hot-zones, 0 disables them")
 
 var cQuit <- chan bool
 
@@ -85,16 +86,16 @@ func pollMousePosition(t time.Time) {
 func mouseHasMoved(x int, y int) {
 	if x == 0 && lastX > 0 && switched == false {
 		switched = true
-		switchInput("left")
+		switchInput(inCorner(x, y, "left"), "left", edgePosition(y, maxY))
 	} else if x == maxX-1 && lastX < maxX-2 && switched == false {
 		switched = true
-		switchInput("right")
+		switchInput(inCorner(x, y, "right"), "right", edgePosition(y, maxY))
 	} else if y == 0 && lastY > 0 && switched == false {
 		switched = true
-		switchInput("top")
+		switchInput(inCorner(x, y, "top"), "top", edgePosition(x, maxX))
 	} else if y == maxY-1 && lastY < maxY-2 && switched == false {
 		switched = true
-		switchInput("bottom")
+		switchInput(inCorner(x, y, "bottom"), "bottom", edgePosition(x, maxX))
 	}
 
 	/*
@@ -110,16 +111,56 @@ func mouseHasMoved(x int, y int) {
 	lastY = y
 }
 
-func switchInput(direction string) {
+// inCorner returns the corner (eg, top_left) the mouse is in when it reaches an edge.
+// If the mouse isn't within cornerSize pixels of a corner, the edge is returned.
+func inCorner(x int, y int, edge string) string {
+	if *cornerSize <= 0 {
+		return edge
+	}
+
+	vertical, horizontal := "", ""
+	if y < *cornerSize {
+		vertical = "top"
+	} else if y >= maxY-*cornerSize {
+		vertical = "bottom"
+	}
+	if x < *cornerSize {
+		horizontal = "left"
+	} else if x >= maxX-*cornerSize {
+		horizontal = "right"
+	}
+
+	if vertical == "" || horizontal == "" {
+		return edge
+	}
+	return vertical + "_" + horizontal
+}
+
+// edgePosition turns a pixel along an edge of the screen into a position between 0.0 and 1.0.
+func edgePosition(pixel int, size int) float64 {
+	if size < 2 {
+		return 0
+	}
+	return float64(pixel) / float64(size-1)
+}
+
+// switchInput asks the server to switch, after the mouse has crossed edge at position (which can be in a corner).
+func switchInput(direction string, edge string, position float64) {
 	if switching == false {
-		debugLog("[Fence]: 📺 Mouse has moved to the %s desktop.", direction)
+		debugLog("[Fence]: 📺 Mouse has moved to the %s desktop (%.2f along the %s edge).", direction, position, edge)
 		switching = true
 	}
 
-	outgoingChanges <- makeSwap(SwapDevice{
+	swap := SwapDevice{
 		Device:    *deviceName,
 		Direction: direction,
-	})
+		Position:  &position,
+	}
+	// The server falls back to the edge that was crossed if the corner has no actions of its own.
+	if direction != edge {
+		swap.Edge = edge
+	}
+	outgoingChanges <- makeSwap(swap)
 }
 
 func makeSwap(swap SwapDevice) string {
@@ -139,6 +180,7 @@ func onReady() {
 	systray.SetTitle("Fence")
 	systray.SetTooltip("Fence: Move to corner, swap your input")
 	mRefresh := systray.AddMenuItem("Refresh", "Refresh the state")
+	mUndo := systray.AddMenuItem("Undo", "Go back to the previous input")
 	mQuit := systray.AddMenuItem("Quit", "Quit the whole app")
 
 	// Sets the icon of a menu item. Only available on Mac and Windows.
@@ -147,6 +189,11 @@ func onReady() {
 		<-mQuit.ClickedCh
 		systray.Quit()
 	}()
+	go func() {
+		for range mUndo.ClickedCh {
+			outgoingChanges <- `{"undo": true}`
+		}
+	}()
 	go func() {
 		<-mRefresh.ClickedCh
 		systray.SetTitle("Refreshing...")
@@ -11,6 +11,13 @@ import (
 type SwapDevice struct {
 	Device    string `json:"device"`
 	Direction string `json:"direction"`
+
+	// Position is where along the edge the mouse left the screen.
+	// 0.0 is the top (for the left & right edges) or the left (for the top & bottom edges), 1.0 is the other end.
+	Position *float64 `json:"position,omitempty"`
+
+	// Edge is the edge the mouse crossed when Direction is a corner (eg, top for top_left).
+	Edge string `json:"edge,omitempty"`
 }
 
 // Unmarshal reads in SwapDevice commands that may have been sent from other clients.
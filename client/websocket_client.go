@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/jpillora/backoff"
 	"golang.org/x/net/websocket"
+	"strings"
 	"time"
 )
 
@@ -78,6 +80,11 @@ func initWebsocketClient() error {
 				switched = false
 				switching = false
 			}
+
+			var ba BroadcastAction
+			if err := ba.Unmarshal([]byte(message)); err == nil {
+				handleBroadcast(ba)
+			}
 		}
 
 		if incomingMessages == nil && outgoingChanges == nil {
@@ -106,3 +113,24 @@ func readClientMessages(ws *websocket.Conn, incomingMessages chan string) {
 		}
 	}
 }
+
+// handleBroadcast lets the user know about things the server has told us (eg, that it could not switch).
+func handleBroadcast(ba BroadcastAction) {
+	switch {
+	case ba.ActionName == "effect_result":
+		var result EffectResult
+		if err := json.Unmarshal(ba.Value, &result); err == nil && !result.Success {
+			fmt.Println(`[websocket] The server could not switch:`, result.Error)
+		}
+	case strings.HasPrefix(ba.ActionName, "driver_"):
+		var event DriverEvent
+		if err := json.Unmarshal(ba.Value, &event); err != nil {
+			return
+		}
+		if event.State == "disconnected" {
+			fmt.Printf("[websocket] The server lost the connection to %s, switching will not work until it is back: %s\n", event.Driver, event.Error)
+		} else {
+			fmt.Printf("[websocket] The server is connected to %s again\n", event.Driver)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// defaultStepTimeout is how long http, shell & wait_for actions are given when they don't have a timeout.
+const defaultStepTimeout = 10 * time.Second
+
+// waitForInterval is how often a driver is asked about an input while waiting for it.
+const waitForInterval = 250 * time.Millisecond
+
+// waitForRefresh is how often a driver is asked to refresh what it knows about its inputs while waiting for one.
+// In between, the driver answers from what it already knows.
+const waitForRefresh = 2 * time.Second
+
+// SleepAction waits before the next action is performed (eg, to give a monitor time to find its new input).
+type SleepAction struct {
+	Milliseconds int `json:"ms" yaml:"ms"`
+}
+
+// HTTPAction sends a request to a URL (eg, a webhook for home automation).
+// The action fails if the server does not respond with a 2xx status.
+type HTTPAction struct {
+	URL     string            `json:"url" yaml:"url"`
+	Method  string            `json:"method,omitempty" yaml:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string            `json:"body,omitempty" yaml:"body,omitempty"`
+	Timeout time.Duration     `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ShellAction runs a command on the server. The action fails if the command exits with an error.
+type ShellAction struct {
+	Command string        `json:"command" yaml:"command"`
+	Args    []string      `json:"args,omitempty" yaml:"args,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// WaitForAction waits until a driver reports that a source is active on one of its inputs.
+type WaitForAction struct {
+	DriverName string        `json:"driver" yaml:"driver"`
+	Input      string        `json:"input" yaml:"input"`
+	Timeout    time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// httpMethods are the methods that an http action can use.
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+// actionKinds are the different kinds of action, in the order they are described to people.
+var actionKinds = []string{"driver", "scene", "barrier", "sleep", "http", "shell", "wait_for"}
+
+// kinds returns every kind of action that has been set (an action should only have one).
+func (a Action) kinds() []string {
+	var kinds []string
+	if a.DriverName != "" || a.isRoute() {
+		kinds = append(kinds, "driver")
+	}
+	if a.Scene != "" {
+		kinds = append(kinds, "scene")
+	}
+	if a.Barrier {
+		kinds = append(kinds, "barrier")
+	}
+	if a.Sleep != nil {
+		kinds = append(kinds, "sleep")
+	}
+	if a.HTTP != nil {
+		kinds = append(kinds, "http")
+	}
+	if a.Shell != nil {
+		kinds = append(kinds, "shell")
+	}
+	if a.WaitFor != nil {
+		kinds = append(kinds, "wait_for")
+	}
+	return kinds
+}
+
+// isRoute checks if an action switches a driver (with either the action string, or input & outputs).
+func (a Action) isRoute() bool {
+	return a.PerformAction != "" || a.Input != "" || a.Output != "" || len(a.Outputs) > 0 || a.Layer != ""
+}
+
+// isStep checks if an action does something other than switch a driver (eg, sleep).
+// Steps are performed on their own: everything before them finishes first, and everything after waits for them.
+func (a Action) isStep() bool {
+	return a.Sleep != nil || a.HTTP != nil || a.Shell != nil || a.WaitFor != nil
+}
+
+// check returns the problems with the settings for an action's kind, along with the field that is wrong.
+func (s *SleepAction) check() (string, string) {
+	if s.Milliseconds <= 0 {
+		return "ms must be more than 0", "ms"
+	}
+	return "", ""
+}
+
+func (h *HTTPAction) check() (string, string) {
+	if h.URL == "" {
+		return "url is required", "url"
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "url must be a http:// or https:// URL", "url"
+	}
+	if h.Method != "" && !contains(httpMethods, strings.ToUpper(h.Method)) {
+		return fmt.Sprintf("method must be one of: %s", strings.Join(httpMethods, ", ")), "method"
+	}
+	if h.Timeout < 0 {
+		return "timeout can not be negative", "timeout"
+	}
+	return "", ""
+}
+
+func (s *ShellAction) check() (string, string) {
+	if s.Command == "" {
+		return "command is required", "command"
+	}
+	if s.Timeout < 0 {
+		return "timeout can not be negative", "timeout"
+	}
+	return "", ""
+}
+
+func (w *WaitForAction) check() (string, string) {
+	if w.DriverName == "" {
+		return "driver is required", "driver"
+	}
+	if w.Input == "" {
+		return "input is required", "input"
+	}
+	if w.Timeout < 0 {
+		return "timeout can not be negative", "timeout"
+	}
+	return "", ""
+}
+
+// timeoutOrDefault returns timeout, or defaultStepTimeout when it has not been set.
+func timeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return defaultStepTimeout
+	}
+	return timeout
+}
+
+// performStep performs an action that does not switch a driver.
+func performStep(item Action) ActionResult {
+	var err error
+	switch {
+	case item.Sleep != nil:
+		time.Sleep(time.Duration(item.Sleep.Milliseconds) * time.Millisecond)
+	case item.HTTP != nil:
+		err = item.HTTP.perform()
+	case item.Shell != nil:
+		err = item.Shell.perform()
+	case item.WaitFor != nil:
+		err = item.WaitFor.perform()
+	}
+
+	if err != nil {
+		return failedAction(item, "%s", err)
+	}
+	return ActionResult{Action: item, Status: ActionPerformed}
+}
+
+func (h *HTTPAction) perform() error {
+	method := strings.ToUpper(h.Method)
+	if method == "" {
+		method = "GET"
+		if h.Body != "" {
+			method = "POST"
+		}
+	}
+
+	var body io.Reader
+	if h.Body != "" {
+		body = strings.NewReader(h.Body)
+	}
+	req, err := http.NewRequest(method, h.URL, body)
+	if err != nil {
+		return err
+	}
+	for name, value := range h.Headers {
+		req.Header.Set(name, value)
+	}
+
+	client := http.Client{Timeout: timeoutOrDefault(h.Timeout)}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request to %s failed: %s", h.URL, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("http request to %s responded with %s", h.URL, res.Status)
+	}
+	return nil
+}
+
+func (s *ShellAction) perform() error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutOrDefault(s.Timeout))
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, s.Command, s.Args...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command [%s] did not finish within %s", s.Command, timeoutOrDefault(s.Timeout))
+	}
+	if err != nil {
+		return fmt.Errorf("command [%s] failed: %s: %s", s.Command, err, strings.TrimSpace(string(output)))
+	}
+	if EnableDebugMode {
+		log.Printf("[shell]: %s: %s", s.Command, output)
+	}
+	return nil
+}
+
+func (w *WaitForAction) perform() error {
+	driver := findDriver(w.DriverName)
+	if driver == nil {
+		return fmt.Errorf("driver [%s] was not found", w.DriverName)
+	}
+	status, ok := driver.(drivers.InputStatus)
+	if !ok {
+		return fmt.Errorf("[%s] can not tell if an input is active", w.DriverName)
+	}
+
+	timeout := time.After(timeoutOrDefault(w.Timeout))
+	var refreshed time.Time
+	for {
+		if active, _ := status.InputActive(drivers.AliasesOf(driver).InputPort(w.Input)); active {
+			return nil
+		}
+
+		select {
+		case <-timeout:
+			return fmt.Errorf("input %s on [%s] did not become active within %s", w.Input, w.DriverName, timeoutOrDefault(w.Timeout))
+		case <-time.After(waitForInterval):
+		}
+
+		// Ask the driver to refresh what it knows about its inputs.
+		if driver.IsRunning() && time.Since(refreshed) >= waitForRefresh {
+			driver.GetStatus()
+			refreshed = time.Now()
+		}
+	}
+}
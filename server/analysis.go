@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// oppositeDirections are the directions that lead back to where the mouse came from.
+var oppositeDirections = map[string]string{
+	"left":         "right",
+	"right":        "left",
+	"top":          "bottom",
+	"bottom":       "top",
+	"top_left":     "bottom_right",
+	"bottom_right": "top_left",
+	"top_right":    "bottom_left",
+	"bottom_left":  "top_right",
+}
+
+// Transition is where moving the mouse in a direction from a computer ends up.
+type Transition struct {
+	From      string `json:"from"`
+	Direction string `json:"direction"`
+	// Edge is the edge (or corner) that the direction is on. It is different to Direction for segments.
+	Edge string `json:"-"`
+	// To is the computer that the desk is switched to ("" if the switch does not match any computer).
+	To string `json:"to,omitempty"`
+}
+
+// AnalysisIssue is a problem found by simulating the layout.
+type AnalysisIssue struct {
+	Severity  Severity `json:"severity"`
+	Computer  string   `json:"computer"`
+	Direction string   `json:"direction,omitempty"`
+	Message   string   `json:"message"`
+}
+
+func (i AnalysisIssue) String() string {
+	if i.Direction == "" {
+		return fmt.Sprintf("%s: [%s]: %s", i.Severity, i.Computer, i.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s: %s", i.Severity, i.Computer, i.Direction, i.Message)
+}
+
+// LayoutAnalysis is what was found by simulating every direction of every computer in a layout.
+type LayoutAnalysis struct {
+	Transitions []Transition    `json:"transitions"`
+	Issues      []AnalysisIssue `json:"issues"`
+}
+
+// HasErrors will be true if any of the issues are errors.
+func (a *LayoutAnalysis) HasErrors() bool {
+	for _, issue := range a.Issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyse simulates moving the mouse in every direction from every computer, to find computers that can't be reached,
+// computers that can't be left, and directions that don't lead back to where they came from.
+//
+// Each computer is identified by the routes its activate actions make. Starting with those routes, the actions for a
+// direction are applied, and the computer whose routes match the result is where the mouse ends up. Conditions are
+// assumed to be met, and steps (eg, sleep) are ignored.
+func (l *Layout) Analyse(driverList []drivers.DriverInterface) *LayoutAnalysis {
+	analysis := &LayoutAnalysis{Transitions: []Transition{}, Issues: []AnalysisIssue{}}
+	report := func(severity Severity, computer, direction, message string, v ...interface{}) {
+		analysis.Issues = append(analysis.Issues, AnalysisIssue{
+			Severity:  severity,
+			Computer:  computer,
+			Direction: direction,
+			Message:   fmt.Sprintf(message, v...),
+		})
+	}
+
+	// Work out what the desk looks like when each computer is active.
+	targets := map[string]RoutingState{}
+	for _, computer := range l.Computers {
+		if len(computer.Activate) == 0 {
+			report(SeverityWarning, computer.Name, "", "there are no activate actions, so where the mouse goes from here can not be checked")
+			continue
+		}
+		state, err := l.simulate(computer.Activate, RoutingState{}, driverList)
+		if err != nil {
+			report(SeverityError, computer.Name, "activate", "%s", err)
+			continue
+		}
+		targets[computer.Name] = state
+	}
+
+	for _, computer := range l.Computers {
+		start, known := targets[computer.Name]
+		if !known {
+			continue
+		}
+
+		for _, list := range computer.actionLists() {
+			if list.name == "activate" || len(list.actions) == 0 {
+				continue
+			}
+
+			state, err := l.simulate(list.actions, start, driverList)
+			if err != nil {
+				report(SeverityError, computer.Name, list.name, "%s", err)
+				continue
+			}
+
+			edge := list.name
+			if len(list.path) > 2 {
+				edge = computer.Directions.Segments[list.path[2].(int)].Edge
+			}
+			transition := Transition{From: computer.Name, Direction: list.name, Edge: edge, To: identify(state, targets)}
+			analysis.Transitions = append(analysis.Transitions, transition)
+			if transition.To == "" {
+				report(SeverityError, computer.Name, list.name, "the desk is left in a state that does not match any computer (%s)", describeState(state))
+			}
+		}
+	}
+
+	l.checkTransitions(analysis, targets, report)
+	return analysis
+}
+
+// checkTransitions looks for dead-ends, unreachable computers, and directions that don't lead back.
+func (l *Layout) checkTransitions(analysis *LayoutAnalysis, targets map[string]RoutingState, report func(Severity, string, string, string, ...interface{})) {
+	if len(targets) < 2 {
+		return
+	}
+
+	leaves := map[string]bool{}
+	reached := map[string]bool{}
+	for _, t := range analysis.Transitions {
+		if t.To != "" && t.To != t.From {
+			leaves[t.From] = true
+			reached[t.To] = true
+		}
+	}
+
+	for _, computer := range l.Computers {
+		if _, known := targets[computer.Name]; !known {
+			continue
+		}
+		if !leaves[computer.Name] {
+			report(SeverityWarning, computer.Name, "", "this is a dead-end, no direction switches to another computer")
+		}
+		if !reached[computer.Name] {
+			report(SeverityWarning, computer.Name, "", "can not be reached by moving the mouse from any other computer")
+		}
+	}
+
+	for _, t := range analysis.Transitions {
+		if t.To == "" || t.To == t.From {
+			continue
+		}
+
+		opposite := oppositeDirections[t.Edge]
+		var back []string
+		for _, other := range analysis.Transitions {
+			if other.From == t.To && other.Edge == opposite {
+				back = append(back, other.To)
+			}
+		}
+
+		switch {
+		case len(back) == 0:
+			report(SeverityWarning, t.From, t.Direction, "goes to [%s], but moving %s from [%s] does nothing", t.To, opposite, t.To)
+		case !contains(back, t.From):
+			sort.Strings(back)
+			report(SeverityWarning, t.From, t.Direction, "goes to [%s], but moving %s from [%s] goes to %v instead of back", t.To, opposite, t.To, back)
+		}
+	}
+}
+
+// simulate applies the routes of actions to a copy of state.
+func (l *Layout) simulate(actions []Action, state RoutingState, driverList []drivers.DriverInterface) (RoutingState, error) {
+	next := state.copy()
+
+	expanded, err := l.expandScenes(actions)
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range expanded {
+		if action.Barrier || action.isStep() {
+			continue
+		}
+
+		var driver drivers.DriverInterface
+		for _, d := range driverList {
+			if d.GetShortName() == action.DriverName {
+				driver = d
+			}
+		}
+		if driver == nil {
+			return nil, fmt.Errorf("driver [%s] has not been configured", action.DriverName)
+		}
+
+		routes, err := action.routes(driver)
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range routes {
+			if route.Layer == "" {
+				next.set(action.DriverName, route.Output, route.Input)
+			}
+		}
+	}
+	return next, nil
+}
+
+// identify finds the computer whose routes are all in state. If more than one computer matches, the computer with the
+// most routes is used. "" is returned if no computer (or more than one equally good computer) matches.
+func identify(state RoutingState, targets map[string]RoutingState) string {
+	best := ""
+	bestRoutes := -1
+	tied := false
+	for name, target := range targets {
+		routes := 0
+		matches := true
+		for driverName, outputs := range target {
+			for output, input := range outputs {
+				if current, _ := state.get(driverName, output); current != input {
+					matches = false
+				}
+				routes++
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		switch {
+		case routes > bestRoutes:
+			best, bestRoutes, tied = name, routes, false
+		case routes == bestRoutes:
+			tied = true
+		}
+	}
+
+	if tied {
+		return ""
+	}
+	return best
+}
+
+// copy returns a copy of the state, that can be changed without changing the original.
+func (r RoutingState) copy() RoutingState {
+	copied := RoutingState{}
+	for driverName, outputs := range r {
+		for output, input := range outputs {
+			copied.set(driverName, output, input)
+		}
+	}
+	return copied
+}
+
+// describeState lists the routes in a state for a person (eg, kvm: 2, matrix: 01-01 02-02).
+func describeState(state RoutingState) string {
+	description := ""
+	for _, action := range *state.actions() {
+		if description != "" {
+			description += ", "
+		}
+		if action.Output == "" {
+			description += fmt.Sprintf("%s %s", action.DriverName, action.Input)
+		} else {
+			description += fmt.Sprintf("%s %s-%s", action.DriverName, action.Output, action.Input)
+		}
+	}
+	return description
+}
+
+// checkCommand prints the analysis of the layout (./server check), returning the exit code.
+func checkCommand(layout *Layout, driverList []drivers.DriverInterface) int {
+	analysis := layout.Analyse(driverList)
+	for _, t := range analysis.Transitions {
+		to := t.To
+		if to == "" {
+			to = "?"
+		}
+		fmt.Printf("%s --%s--> %s\n", t.From, t.Direction, to)
+	}
+	for _, issue := range analysis.Issues {
+		fmt.Println(issue)
+	}
+
+	if analysis.HasErrors() {
+		return 1
+	}
+	if len(analysis.Issues) == 0 {
+		fmt.Println("No problems were found with the layout.")
+	}
+	return 0
+}
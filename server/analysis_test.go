@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+func TestAnalyseFindsDeadEndsAndOneWayDirections(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	driverList := []drivers.DriverInterface{listedMatrix{matrix}, kvm}
+
+	kvmTo := func(input string) []Action { return []Action{{DriverName: "kvm", Input: input}} }
+	layout := &Layout{Computers: []Computer{{
+		Name:       "a",
+		Activate:   kvmTo("1"),
+		Directions: Directions{Right: kvmTo("2")},
+	}, {
+		Name:       "b",
+		Activate:   kvmTo("2"),
+		Directions: Directions{Bottom: kvmTo("3"), Left: []Action{{DriverName: "matrix", Input: "02", Output: "01"}}},
+	}, {
+		Name:     "c",
+		Activate: kvmTo("3"),
+	}}}
+
+	analysis := layout.Analyse(driverList)
+
+	expected := []string{
+		"warning: [c]: this is a dead-end",
+		"warning: [a]: can not be reached",
+		"warning: [a] right: goes to [b], but moving left from [b] goes to [b] instead of back",
+		"warning: [b] bottom: goes to [c], but moving top from [c] does nothing",
+	}
+
+	var found []string
+	for _, issue := range analysis.Issues {
+		found = append(found, issue.String())
+	}
+	for _, message := range expected {
+		matched := false
+		for _, issue := range found {
+			if strings.HasPrefix(issue, message) {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Errorf("Expected an issue starting with %q, got:\n%s", message, strings.Join(found, "\n"))
+		}
+	}
+	if len(found) != len(expected) {
+		t.Errorf("Expected %d issues, got:\n%s", len(expected), strings.Join(found, "\n"))
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+	"gopkg.in/yaml.v3"
+)
+
+// Barrier (and Synergy) describe which screen is next to which in the links section of their configuration:
+//
+//	section: links
+//		home:
+//			right = work
+//			left(0,50) = laptop
+//	end
+//
+// importBarrier turns the links into computers, and exportBarrier writes a layout back out in the same format, so
+// both tools can share one source of truth.
+
+// barrierDirections maps the directions Barrier uses to the edges of a screen.
+var barrierDirections = map[string]string{
+	"left":  "left",
+	"right": "right",
+	"up":    "top",
+	"down":  "bottom",
+}
+
+// barrierLink is a single `direction = screen` line from the links section.
+var barrierLink = regexp.MustCompile(`^(\w+)\s*(?:\(\s*(\d+)\s*,\s*(\d+)\s*\))?\s*=\s*([^\s(]+)\s*(?:\(.*\))?$`)
+
+// BarrierLink is where moving off the edge of a screen goes to.
+// From and To are the part of the edge the link covers (0.0 to 1.0), which is the whole edge unless a range was given.
+type BarrierLink struct {
+	Edge   string
+	From   float64
+	To     float64
+	Screen string
+}
+
+// wholeEdge checks if the link covers the whole edge of the screen.
+func (l BarrierLink) wholeEdge() bool {
+	return l.From == 0 && l.To == 1
+}
+
+// BarrierConfig is the part of a Barrier configuration that describes the screens.
+type BarrierConfig struct {
+	// Screens are in the order they were defined.
+	Screens []string
+	Links   map[string][]BarrierLink
+	// Aliases are other names for a screen (eg, its hostname).
+	Aliases map[string]string
+}
+
+// parseBarrierConfig reads the screens, links & aliases sections of a Barrier configuration. Everything else (eg,
+// options) is ignored. Links from or to an alias are changed to the name of the screen.
+func parseBarrierConfig(r io.Reader) (*BarrierConfig, error) {
+	config := &BarrierConfig{Links: map[string][]BarrierLink{}, Aliases: map[string]string{}}
+	known := map[string]bool{}
+	addScreen := func(name string) {
+		if !known[name] {
+			known[name] = true
+			config.Screens = append(config.Screens, name)
+		}
+	}
+
+	// sources are the screens that have links, in the order they were defined (they might be aliases).
+	var sources []string
+	section := ""
+	screen := ""
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "section:"):
+			if section != "" {
+				return nil, fmt.Errorf("line %d: section %s has not been ended", number, section)
+			}
+			section = strings.TrimSpace(strings.TrimPrefix(line, "section:"))
+			screen = ""
+			continue
+		case line == "end":
+			if section == "" {
+				return nil, fmt.Errorf("line %d: end is not inside a section", number)
+			}
+			section = ""
+			continue
+		case section == "":
+			return nil, fmt.Errorf("line %d: %q is not inside a section", number, line)
+		}
+
+		if section != "screens" && section != "links" && section != "aliases" {
+			continue
+		}
+		if strings.HasSuffix(line, ":") {
+			screen = strings.TrimSpace(strings.TrimSuffix(line, ":"))
+			if section != "links" {
+				addScreen(screen)
+			} else if !contains(sources, screen) {
+				sources = append(sources, screen)
+			}
+			continue
+		}
+		if screen == "" {
+			return nil, fmt.Errorf("line %d: %q is not inside a screen", number, line)
+		}
+
+		switch section {
+		case "aliases":
+			config.Aliases[line] = screen
+		case "links":
+			match := barrierLink.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("line %d: %q should look like: right = other-screen", number, line)
+			}
+			edge, ok := barrierDirections[match[1]]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown direction [%s] (left, right, up or down)", number, match[1])
+			}
+
+			link := BarrierLink{Edge: edge, From: 0, To: 1, Screen: match[4]}
+			if match[2] != "" {
+				from, _ := strconv.Atoi(match[2])
+				to, _ := strconv.Atoi(match[3])
+				if from >= to || to > 100 {
+					return nil, fmt.Errorf("line %d: the range (%d,%d) must be between 0 and 100, and the start must be less than the end", number, from, to)
+				}
+				link.From, link.To = float64(from)/100, float64(to)/100
+			}
+			config.Links[screen] = append(config.Links[screen], link)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if section != "" {
+		return nil, fmt.Errorf("section %s has not been ended", section)
+	}
+
+	// The aliases section can come after the links, so aliases are only changed to screens once everything is read.
+	screenFor := func(name string) string {
+		if screen, isAlias := config.Aliases[name]; isAlias {
+			return screen
+		}
+		return name
+	}
+	for _, source := range sources {
+		addScreen(screenFor(source))
+	}
+
+	links := map[string][]BarrierLink{}
+	for _, source := range sources {
+		from := screenFor(source)
+		for _, link := range config.Links[source] {
+			link.Screen = screenFor(link.Screen)
+			if !known[link.Screen] {
+				return nil, fmt.Errorf("[%s] links to [%s], which is not a screen", from, link.Screen)
+			}
+			links[from] = append(links[from], link)
+		}
+	}
+	config.Links = links
+	return config, nil
+}
+
+// importBarrier builds a configuration with a computer for each screen, using the links between them as directions.
+//
+// Each computer is activated by a scene with the same name, and moving to a computer performs its scene. Barrier
+// does not know about the devices, so there are no drivers, and the scenes are empty placeholders. They need to be
+// changed to the routes that make each computer the active machine.
+func importBarrier(barrier *BarrierConfig) *Config {
+	config := &Config{Drivers: []drivers.Config{}}
+
+	for _, screen := range barrier.Screens {
+		computer := Computer{Name: screen, Activate: []Action{{Scene: screen}}}
+		for _, link := range barrier.Links[screen] {
+			actions := []Action{{Scene: link.Screen}}
+			if link.wholeEdge() {
+				*computer.Directions.actionsFor(link.Edge) = actions
+				continue
+			}
+			computer.Directions.Segments = append(computer.Directions.Segments, EdgeSegment{
+				Edge:    link.Edge,
+				From:    link.From,
+				To:      link.To,
+				Actions: actions,
+			})
+		}
+		config.Layout.Computers = append(config.Layout.Computers, computer)
+
+		config.Layout.Scenes = append(config.Layout.Scenes, Scene{Name: screen, Actions: []Action{}})
+	}
+	return config
+}
+
+// exportBarrier writes the screens & links sections of a Barrier configuration for the layout.
+//
+// A direction links to the computer whose activate actions are the same as the direction's. Otherwise, the
+// direction is simulated (see Analyse) to find where the mouse ends up. Corners are left out, Barrier does not
+// have them.
+func exportBarrier(layout *Layout, driverList []drivers.DriverInterface, w io.Writer) error {
+	analysis := layout.Analyse(driverList)
+	transitions := map[string]string{}
+	for _, t := range analysis.Transitions {
+		transitions[t.From+"/"+t.Direction] = t.To
+	}
+
+	destination := func(computer Computer, direction string, actions []Action) string {
+		if to := layout.computerActivatedBy(actions); to != "" {
+			return to
+		}
+		return transitions[computer.Name+"/"+direction]
+	}
+
+	barrierNames := map[string]string{}
+	for name, edge := range barrierDirections {
+		barrierNames[edge] = name
+	}
+
+	var b strings.Builder
+	b.WriteString("section: screens\n")
+	for _, computer := range layout.Computers {
+		fmt.Fprintf(&b, "\t%s:\n", computer.Name)
+	}
+	b.WriteString("end\n\nsection: links\n")
+	for _, computer := range layout.Computers {
+		fmt.Fprintf(&b, "\t%s:\n", computer.Name)
+		for _, list := range computer.actionLists() {
+			if len(list.actions) == 0 || list.name == "activate" {
+				continue
+			}
+
+			to := destination(computer, list.name, list.actions)
+			if to == "" || to == computer.Name {
+				log.Printf("[barrier]: Leaving out %s of [%s], it does not go to another computer", list.name, computer.Name)
+				continue
+			}
+			if isEdge(list.name) {
+				fmt.Fprintf(&b, "\t\t%s = %s\n", barrierNames[list.name], to)
+			} else if len(list.path) > 2 {
+				segment := computer.Directions.Segments[list.path[2].(int)]
+				fmt.Fprintf(&b, "\t\t%s(%d,%d) = %s\n", barrierNames[segment.Edge], int(segment.From*100+0.5), int(segment.To*100+0.5), to)
+			}
+		}
+	}
+	b.WriteString("end\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// computerActivatedBy finds the computer whose activate actions are the same as actions.
+func (l *Layout) computerActivatedBy(actions []Action) string {
+	for _, computer := range l.Computers {
+		if len(computer.Activate) > 0 && reflect.DeepEqual(computer.Activate, actions) {
+			return computer.Name
+		}
+	}
+	return ""
+}
+
+// importBarrierCommand prints a configuration for the Barrier configuration at path (./server import-barrier <path>),
+// returning the exit code.
+func importBarrierCommand(path string) int {
+	if path == "" {
+		log.Println("Usage: ./server import-barrier <barrier.conf>")
+		return 2
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Could not open %s: %s", path, err)
+		return 1
+	}
+	defer f.Close()
+
+	barrier, err := parseBarrierConfig(f)
+	if err != nil {
+		log.Printf("Could not read %s: %s", path, err)
+		return 1
+	}
+
+	fmt.Printf("# Imported from %s. Add the drivers for your devices, then fill in the (empty) scene for each\n"+
+		"# computer with the routes that make it the active machine.\n", path)
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(importBarrier(barrier)); err != nil {
+		log.Printf("Could not write the configuration: %s", err)
+		return 1
+	}
+	return 0
+}
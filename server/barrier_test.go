@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testBarrierConfig = `
+section: screens
+	home:
+		halfDuplexCapsLock = false
+	work:
+	laptop:
+end
+
+section: aliases
+	work:
+		work.local
+end
+
+section: links
+	home:
+		right = work.local   # an alias
+		left(0,50) = laptop
+	work.local:          # an alias
+		left = home
+	laptop:
+		right(0,100) = home
+end
+
+section: options
+	switchDelay = 250
+end
+`
+
+func TestImportBarrierConfig(t *testing.T) {
+	barrier, err := parseBarrierConfig(strings.NewReader(testBarrierConfig))
+	if err != nil {
+		t.Fatalf("Could not parse the config: %s", err)
+	}
+	if strings.Join(barrier.Screens, ",") != "home,work,laptop" {
+		t.Errorf("Expected the screens home, work & laptop, got %v", barrier.Screens)
+	}
+
+	if links := barrier.Links["work"]; len(links) != 1 || links[0].Screen != "home" {
+		t.Errorf("Expected the links from the work.local alias to be from work, got %+v", barrier.Links)
+	}
+
+	config := importBarrier(barrier)
+	home := config.Layout.Computers[0]
+	if len(home.Directions.Right) != 1 || home.Directions.Right[0].Scene != "work" {
+		t.Errorf("Expected right from home to perform the work scene, got %+v", home.Directions.Right)
+	}
+	if len(home.Directions.Segments) != 1 || home.Directions.Segments[0].Edge != "left" || home.Directions.Segments[0].To != 0.5 {
+		t.Errorf("Expected the top half of the left edge of home to be a segment, got %+v", home.Directions.Segments)
+	}
+	if laptop := config.Layout.Computers[2]; len(laptop.Directions.Right) != 1 {
+		t.Errorf("Expected a range covering the whole edge to be the edge, got %+v", laptop.Directions)
+	}
+
+	// The imported configuration should be usable as it is.
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := parseConfig(data)
+	if err != nil {
+		t.Fatalf("The imported configuration could not be loaded: %s", err)
+	}
+	if err := checkLayout(&imported.Layout, nil); err != nil {
+		t.Errorf("The imported layout has errors: %s", err)
+	}
+	if issues := imported.Layout.Validate(nil); len(issues) == 0 || !strings.Contains(issues[len(issues)-1].String(), "scene [laptop]: there are no actions") {
+		t.Errorf("Expected a warning for each of the empty scenes, got:\n%s", issues)
+	}
+	if len(imported.Drivers) != 0 {
+		t.Errorf("Expected the drivers to be left for people to add, got %+v", imported.Drivers)
+	}
+
+	var exported strings.Builder
+	if err := exportBarrier(&config.Layout, nil, &exported); err != nil {
+		t.Fatal(err)
+	}
+	expected := "section: screens\n\thome:\n\twork:\n\tlaptop:\nend\n\n" +
+		"section: links\n\thome:\n\t\tright = work\n\t\tleft(0,50) = laptop\n\twork:\n\t\tleft = home\n\tlaptop:\n\t\tright = home\nend\n"
+	if exported.String() != expected {
+		t.Errorf("Expected the export to be:\n%s\ngot:\n%s", expected, exported.String())
+	}
+}
+
+func TestBarrierConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"section: links\n\ta:\n\t\tsideways = b\nend\n", "line 3: unknown direction [sideways]"},
+		{"section: links\n\ta:\n\t\tright = b\nend\n", "[a] links to [b], which is not a screen"},
+		{"section: links\n\ta:\n\t\tleft(50,10) = a\nend\n", "line 3: the range (50,10)"},
+		{"section: screens\n\ta:\n", "section screens has not been ended"},
+		{"a:\n", "line 1: \"a:\" is not inside a section"},
+	}
+
+	for _, test := range tests {
+		_, err := parseBarrierConfig(strings.NewReader(test.config))
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Expected an error starting with %q, got %v", test.err, err)
+		}
+	}
+}
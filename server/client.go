@@ -39,6 +39,12 @@ var upgrader = websocket.Upgrader{
 type SwapDevice struct {
 	Device    string `json:"device" kvm:"required"`
 	Direction string `json:"direction" kvm:"required"`
+
+	// Position is where along the edge the mouse left the screen (0.0 - 1.0). Older clients do not send it.
+	Position *float64 `json:"position,omitempty"`
+
+	// Edge is the edge the mouse crossed when Direction is a corner (eg, top for top_left). Older clients do not send it.
+	Edge string `json:"edge,omitempty"`
 }
 
 // Client is a middleman between the websocket connection and the hub.
@@ -75,7 +81,7 @@ func (c *Client) readPump() {
 		}
 
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
-		c.hub.broadcast <- message
+		c.hub.broadcast <- clientMessage{from: c, data: message}
 	}
 }
 
@@ -142,12 +148,18 @@ func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 }
 
 func (sd *SwapDevice) Unmarshal(data []byte) error {
-	err := json.Unmarshal(data, sd)
+	return unmarshalMessage(data, sd)
+}
+
+// unmarshalMessage reads a message from a client into v (a pointer to a struct).
+// Any field tagged with `kvm:"required"` must be present, so that different messages can be told apart.
+func unmarshalMessage(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
 	if err != nil {
 		return err
 	}
 
-	fields := reflect.ValueOf(sd).Elem()
+	fields := reflect.ValueOf(v).Elem()
 	for i := 0; i < fields.NumField(); i++ {
 
 		dsTags := fields.Type().Field(i).Tag.Get("kvm")
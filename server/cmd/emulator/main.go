@@ -0,0 +1,112 @@
+// The emulator pretends to be a device that Fence has a driver for, so the server can be run without the hardware.
+//
+//	go run ./cmd/emulator -device blustream -listen 127.0.0.1:2323
+//	go run ./cmd/emulator -device blustream -pty -size 8x8 -disconnected 3,4
+//	go run ./cmd/emulator -device startech -pty -size 4
+//
+// While a KVM is being emulated, typing a port number (and enter) presses the button for that port on its front.
+// Point a driver at it with `transport: tcp` and `address: 127.0.0.1:2323`, or with the pty as its `serial_device`.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/timgws/kvm-switch/server/emulator"
+)
+
+var device = flag.String("device", "blustream", "the device to emulate (blustream, startech)")
+var listen = flag.String("listen", "127.0.0.1:2323", "address to accept TCP connections on")
+var usePty = flag.Bool("pty", false, "create a pty to use as the serial_device, instead of listening on TCP")
+var size = flag.String("size", "", "the number of inputs & outputs of a matrix (eg, 4x4 or 8x8, the default), or ports of a KVM (eg, 4, the default)")
+var disconnected = flag.String("disconnected", "", "inputs that do not have a source plugged in to them (eg, 3,4)")
+
+func main() {
+	flag.Parse()
+
+	emulated, err := newDevice()
+	if err != nil {
+		log.Fatalf("[emulator]: %s", err)
+	}
+
+	if *usePty {
+		pty, err := emulator.OpenPty(emulated)
+		if err != nil {
+			log.Fatalf("[emulator]: Could not create a pty: %s", err)
+		}
+		defer pty.Close()
+		log.Printf("[emulator]: Emulating %s on serial_device: %s", *device, pty.Name)
+	} else {
+		listener, err := emulator.Listen(emulated, *listen)
+		if err != nil {
+			log.Fatalf("[emulator]: Could not listen on %s: %s", *listen, err)
+		}
+		defer listener.Close()
+		log.Printf("[emulator]: Emulating %s on address: %s", *device, listener.Addr())
+	}
+
+	if kvm, ok := emulated.(*emulator.Startech); ok {
+		go pressButtons(kvm)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+}
+
+// newDevice creates the emulator for the device that was asked for.
+func newDevice() (emulator.Device, error) {
+	switch *device {
+	case "blustream":
+		if *size == "" {
+			*size = "4x4"
+		}
+		var inputs, outputs int
+		if _, err := fmt.Sscanf(*size, "%dx%d", &inputs, &outputs); err != nil || inputs < 1 || outputs < 1 {
+			return nil, fmt.Errorf("size should look like 4x4, not %q", *size)
+		}
+		matrix := emulator.NewBlustream(inputs, outputs)
+
+		if *disconnected != "" {
+			for _, input := range strings.Split(*disconnected, ",") {
+				number, err := strconv.Atoi(strings.TrimSpace(input))
+				if err != nil || number < 1 || number > inputs {
+					return nil, fmt.Errorf("there is no input %q on a %s matrix", input, *size)
+				}
+				matrix.SetConnected(number, false)
+			}
+		}
+		return matrix, nil
+	case "startech":
+		if *size == "" {
+			*size = "4"
+		}
+		ports, err := strconv.Atoi(*size)
+		if err != nil || ports < 1 || ports > 9 {
+			return nil, fmt.Errorf("size should be the number of ports on the KVM (1-9), not %q", *size)
+		}
+		return emulator.NewStartech(ports), nil
+	}
+	return nil, fmt.Errorf("there is no emulator for [%s]", *device)
+}
+
+// pressButtons presses the button on the front of the KVM for each port number that is typed in.
+func pressButtons(kvm *emulator.Startech) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		port, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			log.Printf("[emulator]: Type the number of a port to press its button")
+			continue
+		}
+		kvm.Press(port)
+		log.Printf("[emulator]: Pressed the button for port %d, the KVM is on port %d", port, kvm.Current())
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// Condition is checked against what a driver knows about one of its inputs (eg, is a source connected to it).
+// Conditions are checked right before the actions they guard are performed, not when the layout is loaded.
+type Condition struct {
+	DriverName string `json:"driver" yaml:"driver"`
+	Input      string `json:"input" yaml:"input"`
+
+	// Active is what the input needs to be for the condition to be met. When it is not set, the input needs to be active.
+	Active *bool `json:"active,omitempty" yaml:"active,omitempty"`
+}
+
+func (c *Condition) String() string {
+	if c.wantActive() {
+		return fmt.Sprintf("input %s on [%s] is active", c.Input, c.DriverName)
+	}
+	return fmt.Sprintf("input %s on [%s] is not active", c.Input, c.DriverName)
+}
+
+// wantActive returns if the input needs to be active for the condition to be met.
+func (c *Condition) wantActive() bool {
+	return c.Active == nil || *c.Active
+}
+
+// check returns the problem with a condition in the configuration, along with the field that is wrong.
+func (c *Condition) check() (string, string) {
+	if c.DriverName == "" {
+		return "driver is required", "driver"
+	}
+	if c.Input == "" {
+		return "input is required", "input"
+	}
+	return "", ""
+}
+
+// conditionStatusTimeout is how long a driver is given to send a fresh status before a condition is checked.
+const conditionStatusTimeout = 2 * time.Second
+
+// conditionStatusInterval is how often the driver is checked for the fresh status.
+const conditionStatusInterval = 20 * time.Millisecond
+
+// met asks the driver about the input, to see if the condition is met. Drivers that read their status in the
+// background are asked for a fresh one first, as a source might have been turned off since it was last read.
+// If the driver can't tell us about the input, the condition is treated as met (the same as not having a condition).
+// If the driver can, but does not know about the input, the condition is not met.
+func (c *Condition) met() bool {
+	driver := findDriver(c.DriverName)
+	if driver == nil {
+		log.Printf("[conditions]: driver [%s] was not found, assuming %s", c.DriverName, c)
+		return true
+	}
+
+	status, ok := driver.(drivers.InputStatus)
+	if !ok {
+		log.Printf("[conditions]: [%s] can not tell if an input is active, assuming %s", c.DriverName, c)
+		return true
+	}
+
+	refreshStatus(driver)
+	active, known := status.InputActive(drivers.AliasesOf(driver).InputPort(c.Input))
+	if !known {
+		log.Printf("[conditions]: the state of input %s on [%s] is not known, so %s is not met", c.Input, c.DriverName, c)
+		return false
+	}
+	return active == c.wantActive()
+}
+
+// refreshStatus asks a driver for its status, waiting up to conditionStatusTimeout for it to be read.
+// Drivers that can't tell us when their status was read are left alone.
+func refreshStatus(driver drivers.DriverInterface) {
+	reader, ok := driver.(drivers.StatusReader)
+	if !ok || !driver.IsRunning() {
+		return
+	}
+
+	asked := time.Now()
+	driver.GetStatus()
+	for deadline := asked.Add(conditionStatusTimeout); reader.StatusRead().Before(asked); time.Sleep(conditionStatusInterval) {
+		if time.Now().After(deadline) {
+			log.Printf("[conditions]: [%s] did not send its status within %s, using what it already knew", driver.GetShortName(), conditionStatusTimeout)
+			return
+		}
+	}
+}
+
+// validateCondition checks that the driver for a condition can tell us about the input.
+func validateCondition(c *Condition, driverList []drivers.DriverInterface) (Severity, string) {
+	var driver drivers.DriverInterface
+	for _, d := range driverList {
+		if d.GetShortName() == c.DriverName {
+			driver = d
+		}
+	}
+	if driver == nil {
+		return SeverityError, fmt.Sprintf("the condition uses driver [%s], which has not been configured", c.DriverName)
+	}
+	if _, ok := driver.(drivers.InputStatus); !ok {
+		return SeverityWarning, fmt.Sprintf("[%s] can not tell if an input is active, so the condition will always be met", c.DriverName)
+	}
+	if ports, ok := driver.(drivers.PortLister); ok && !contains(ports.InputNames(), drivers.AliasesOf(driver).InputPort(c.Input)) {
+		return SeverityError, fmt.Sprintf("the condition uses input [%s], but [%s] does not have it (inputs: %s)", c.Input, c.DriverName, ports.InputNames())
+	}
+	return "", ""
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the top level of a Fence configuration file.
+// Both YAML and JSON files are accepted (JSON is read as YAML, so errors are reported with line numbers).
+type Config struct {
+	Drivers []drivers.Config `json:"drivers" yaml:"drivers"`
+	Layout  Layout           `json:"layout" yaml:"layout"`
+}
+
+// builtInConfig is used when the server has been started without a configuration file.
+func builtInConfig() *Config {
+	return &Config{
+		Drivers: []drivers.Config{{
+			Type:         "startech_kvm",
+			ShortName:    "kvm",
+			SerialDevice: "/dev/tty.usbserial-141140",
+		}, {
+			Type:         "blustream",
+			ShortName:    "matrix",
+			SerialDevice: "/dev/tty.usbserial-141130",
+		}},
+		Layout: *BuildLayout(),
+	}
+}
+
+// ConfigError describes a single problem found while reading a configuration file.
+type ConfigError struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ConfigErrors holds every problem that was found in a configuration file.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// loadConfig reads the configuration file at path.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConfig(data)
+}
+
+// parseConfig decodes a configuration file, refusing unknown keys, then checks that every entry makes sense.
+func parseConfig(data []byte) (*Config, error) {
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("could not read config: the file is empty")
+		}
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	if errs := config.check(&root); len(errs) > 0 {
+		return nil, errs
+	}
+	config.Layout.deriveDirections()
+
+	return &config, nil
+}
+
+// check makes sure that the entries in the configuration are usable.
+// root is used to find the line number of any entry that has a problem.
+func (c *Config) check(root *yaml.Node) ConfigErrors {
+	var errs ConfigErrors
+	report := func(message string, path ...interface{}) {
+		errs = append(errs, ConfigError{
+			Line:    lineOf(root, path...),
+			Path:    formatPath(path...),
+			Message: message,
+		})
+	}
+
+	driverNames := map[string]bool{}
+	for i, driver := range c.Drivers {
+		if driver.Type == "" {
+			report("type is required", "drivers", i)
+		} else if !drivers.IsRegistered(driver.Type) {
+			report(fmt.Sprintf("unknown driver type [%s] (available: %s)", driver.Type, strings.Join(drivers.Types(), ", ")), "drivers", i, "type")
+		}
+
+		if driver.ShortName == "" {
+			report("name is required", "drivers", i)
+		} else if driverNames[driver.ShortName] {
+			report(fmt.Sprintf("driver [%s] has already been defined", driver.ShortName), "drivers", i, "name")
+		}
+		driverNames[driver.ShortName] = true
+
+		switch driver.TransportName() {
+		case drivers.TransportSerial:
+			if driver.SerialDevice == "" {
+				report("serial_device is required", "drivers", i)
+			}
+		case drivers.TransportTCP:
+			if driver.Address == "" {
+				report("address is required when the transport is tcp", "drivers", i)
+			}
+		default:
+			report(fmt.Sprintf("transport must be one of: %s", strings.Join(drivers.Transports, ", ")), "drivers", i, "transport")
+		}
+
+		// The names of the ports come from the driver (eg, "01" on a matrix, "1" on a KVM), so that an alias can't
+		// hide one of them.
+		var inputNames, outputNames []string
+		if created, err := drivers.New(driver); err == nil {
+			if ports, ok := created.(drivers.PortLister); ok {
+				inputNames, outputNames = ports.InputNames(), ports.OutputNames()
+			}
+		}
+
+		for _, ports := range []struct {
+			name    string
+			aliases map[string]string
+			names   []string
+		}{{"inputs", driver.Aliases.Inputs, inputNames}, {"outputs", driver.Aliases.Outputs, outputNames}} {
+			used := map[string]string{}
+			for _, port := range sortedKeys(ports.aliases) {
+				alias := ports.aliases[port]
+				path := []interface{}{"drivers", i, "aliases", ports.name, port}
+				switch {
+				case alias == "":
+					report("alias can not be empty", path...)
+				case alias == AllOutputs:
+					report(fmt.Sprintf("%q can not be used as an alias", AllOutputs), path...)
+				case used[alias] != "":
+					report(fmt.Sprintf("alias [%s] is already used for %s", alias, used[alias]), path...)
+				default:
+					if _, isPort := ports.aliases[alias]; isPort || contains(ports.names, alias) {
+						report(fmt.Sprintf("alias [%s] is the name of another port", alias), path...)
+					}
+				}
+				used[alias] = port
+			}
+		}
+	}
+
+	if len(c.Layout.Computers) == 0 {
+		report("no computers have been defined", "layout")
+	}
+
+	var checkAction func(action Action, path ...interface{})
+
+	// checkCondition checks the when & else of an action or scene.
+	checkCondition := func(when *Condition, elseActions []Action, path ...interface{}) {
+		if when == nil {
+			if len(elseActions) > 0 {
+				report("else can only be used with when", append(path, "else")...)
+			}
+			return
+		}
+		if message, field := when.check(); message != "" {
+			report(message, append(path, "when", field)...)
+		}
+		for j, action := range elseActions {
+			checkAction(action, append(path, "else", j)...)
+		}
+	}
+
+	checkAction = func(action Action, path ...interface{}) {
+		path = append([]interface{}(nil), path...)
+		if action.Barrier && action.When != nil {
+			report("a barrier can not have a condition", append(path, "when")...)
+		}
+		checkCondition(action.When, action.Else, path...)
+
+		if kinds := action.kinds(); len(kinds) > 1 {
+			report(fmt.Sprintf("an action can only be one of: %s (this one is %s)", strings.Join(actionKinds, ", "), strings.Join(kinds, " and ")), path...)
+			return
+		}
+
+		var message, field string
+		switch {
+		case action.Barrier:
+			return
+		case action.Scene != "":
+			if c.Layout.findScene(action.Scene) == nil {
+				report(fmt.Sprintf("scene [%s] has not been defined", action.Scene), append(path, "scene")...)
+			}
+			return
+		case action.Sleep != nil:
+			message, field = action.Sleep.check()
+			path = append(path, "sleep")
+		case action.HTTP != nil:
+			message, field = action.HTTP.check()
+			path = append(path, "http")
+		case action.Shell != nil:
+			message, field = action.Shell.check()
+			path = append(path, "shell")
+		case action.WaitFor != nil:
+			message, field = action.WaitFor.check()
+			path = append(path, "wait_for")
+		}
+		if action.isStep() {
+			if message != "" {
+				report(message, append(path, field)...)
+			}
+			return
+		}
+
+		if action.DriverName == "" {
+			report("driver is required", path...)
+		}
+		structured := action.Input != "" || action.Output != "" || len(action.Outputs) > 0 || action.Layer != ""
+		switch {
+		case action.PerformAction != "" && structured:
+			report("use either action, or input & output, but not both", path...)
+		case action.PerformAction == "" && action.Input == "":
+			report("action (or input) is required", path...)
+		case action.Output != "" && len(action.Outputs) > 0:
+			report("use either output or outputs, but not both", append(path, "outputs")...)
+		case action.Layer != "" && !contains(layerNames, action.Layer):
+			report(fmt.Sprintf("layer must be one of: %s", strings.Join(layerNames, ", ")), append(path, "layer")...)
+		}
+	}
+
+	seen := map[string]bool{}
+	grid := map[GridPosition]string{}
+	for i, computer := range c.Layout.Computers {
+		if computer.Name == "" {
+			report("name is required", "layout", "computers", i)
+		} else if seen[computer.Name] {
+			report(fmt.Sprintf("computer [%s] has already been defined", computer.Name), "layout", "computers", i, "name")
+		}
+		seen[computer.Name] = true
+
+		for j, segment := range computer.Directions.Segments {
+			path := []interface{}{"layout", "computers", i, "directions", "segments", j}
+			if !isEdge(segment.Edge) {
+				report(fmt.Sprintf("edge must be one of: %s", strings.Join(edgeNames, ", ")), append(path, "edge")...)
+			}
+			if segment.From < 0 || segment.To > 1 || segment.From >= segment.To {
+				report("from and to must be between 0.0 and 1.0, and from must be less than to", path...)
+			}
+			if len(segment.Actions) == 0 {
+				report("actions are required", path...)
+			}
+		}
+
+		for _, list := range computer.actionLists() {
+			for j, action := range list.actions {
+				path := append([]interface{}{"layout", "computers", i}, list.path...)
+				checkAction(action, append(path, j)...)
+			}
+		}
+
+		if computer.Grid != nil {
+			if len(computer.Activate) == 0 {
+				report("activate is required when a grid position is set", "layout", "computers", i, "grid")
+			}
+			if other, taken := grid[*computer.Grid]; taken {
+				report(fmt.Sprintf("[%s] is already at this grid position", other), "layout", "computers", i, "grid")
+			}
+			grid[*computer.Grid] = computer.Name
+		}
+	}
+
+	scenes := map[string]bool{}
+	for i, scene := range c.Layout.Scenes {
+		if scene.Name == "" {
+			report("name is required", "layout", "scenes", i)
+		} else if scenes[scene.Name] {
+			report(fmt.Sprintf("scene [%s] has already been defined", scene.Name), "layout", "scenes", i, "name")
+		}
+		scenes[scene.Name] = true
+
+		checkCondition(scene.When, scene.Else, "layout", "scenes", i)
+		for j, action := range scene.Actions {
+			checkAction(action, "layout", "scenes", i, "actions", j)
+		}
+	}
+
+	if c.Layout.HomeScene != "" && c.Layout.findScene(c.Layout.HomeScene) == nil {
+		report(fmt.Sprintf("scene [%s] has not been defined", c.Layout.HomeScene), "layout", "home_scene")
+	}
+
+	if cycle := c.Layout.findSceneCycle(); cycle != nil {
+		for i, scene := range c.Layout.Scenes {
+			if scene.Name == cycle[0] {
+				report(fmt.Sprintf("scenes can not refer to themselves (%s)", formatSceneCycle(cycle)), "layout", "scenes", i)
+			}
+		}
+	}
+
+	return errs
+}
+
+// sortedKeys returns the keys of a map in order, so that errors are always reported in the same order.
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lineOf finds the line of the node at path (map keys are strings, sequence entries are ints).
+// If the path cannot be followed to the end, the line of the deepest node that was found is returned.
+func lineOf(root *yaml.Node, path ...interface{}) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, element := range path {
+		var next *yaml.Node
+		switch key := element.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == key {
+						next = node.Content[i+1]
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+				next = node.Content[key]
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		node = next
+	}
+
+	return node.Line
+}
+
+// formatPath turns a path into something a person can find in their config file (eg, layout.computers[1].name).
+func formatPath(path ...interface{}) string {
+	var b strings.Builder
+	for _, element := range path {
+		switch key := element.(type) {
+		case string:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(key)
+		case int:
+			fmt.Fprintf(&b, "[%d]", key)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"github.com/timgws/kvm-switch/server/drivers"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExampleConfigMatchesBuiltInConfig(t *testing.T) {
+	config, err := loadConfig("config.example.yaml")
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	if !reflect.DeepEqual(config, builtInConfig()) {
+		t.Fatalf("The example config does not match the built-in config")
+	}
+}
+
+func TestConfigDrivers(t *testing.T) {
+	config, err := parseConfig([]byte(`drivers:
+  - type: blustream
+    name: matrix-1
+    serial_device: /dev/ttyUSB0
+    timeout: 2s
+  - type: blustream
+    name: matrix-2
+    serial_device: /dev/ttyUSB1
+layout:
+  computers:
+    - name: pc1
+`))
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	for i, name := range []string{"matrix-1", "matrix-2"} {
+		driver, err := drivers.New(config.Drivers[i])
+		if err != nil {
+			t.Fatalf("There was an error: %s", err)
+		}
+		if driver.GetShortName() != name {
+			t.Errorf("Expected driver %d to be named %s, got %s", i, name, driver.GetShortName())
+		}
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	config, err := parseConfig([]byte(`{
+	"layout": {
+		"computers": [
+			{"name": "pc1", "directions": {"left": [{"driver": "kvm", "action": "2"}]}}
+		]
+	}
+}`))
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	actions, _ := config.Layout.FindActions("pc1", "left")
+	if actions == nil || (*actions)[0].PerformAction != "2" {
+		t.Fatalf("Expected to find the left action for pc1, got %v", actions)
+	}
+}
+
+func TestConfigErrorsHaveLineNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		error  string
+	}{{
+		name: "unknown key",
+		config: `layout:
+  computers:
+    - name: pc1
+      colour: blue
+`,
+		error: "line 4: field colour not found",
+	}, {
+		name: "missing driver",
+		config: `layout:
+  computers:
+    - name: pc1
+      directions:
+        left:
+          - action: "2"
+`,
+		error: "line 6: layout.computers[0].directions.left[0]: driver is required",
+	}, {
+		name: "duplicate computer",
+		config: `layout:
+  computers:
+    - name: pc1
+    - name: pc1
+`,
+		error: "line 4: layout.computers[1].name: computer [pc1] has already been defined",
+	}, {
+		name: "malformed entry",
+		config: `layout:
+  computers:
+    - name: pc1
+      directions:
+        left: "kvm 2"
+`,
+		error: "line 5: cannot unmarshal",
+	}, {
+		name: "unknown driver type",
+		config: `drivers:
+  - type: extron
+    name: matrix
+    serial_device: /dev/ttyUSB0
+layout:
+  computers:
+    - name: pc1
+`,
+		error: "line 2: drivers[0].type: unknown driver type [extron]",
+	}, {
+		name: "two kinds of action",
+		config: `layout:
+  computers:
+    - name: pc1
+      directions:
+        left:
+          - scene: home
+            sleep:
+              ms: 100
+`,
+		error: "line 6: layout.computers[0].directions.left[0]: an action can only be one of",
+	}, {
+		name: "sleep without a time",
+		config: `layout:
+  computers:
+    - name: pc1
+      directions:
+        left:
+          - sleep:
+              ms: 0
+`,
+		error: "line 7: layout.computers[0].directions.left[0].sleep.ms: ms must be more than 0",
+	}, {
+		name: "http without a scheme",
+		config: `layout:
+  computers:
+    - name: pc1
+      directions:
+        left:
+          - http:
+              url: example.com/hook
+`,
+		error: "line 7: layout.computers[0].directions.left[0].http.url: url must be a http:// or https:// URL",
+	}, {
+		name: "condition without an input",
+		config: `layout:
+  computers:
+    - name: pc1
+      directions:
+        left:
+          - driver: matrix
+            action: "01-03"
+            when:
+              driver: matrix
+`,
+		error: "line 9: layout.computers[0].directions.left[0].when.input: input is required",
+	}, {
+		name: "duplicate alias",
+		config: `drivers:
+  - type: blustream
+    name: matrix
+    serial_device: /dev/ttyUSB0
+    aliases:
+      inputs:
+        "01": ps5
+        "02": ps5
+layout:
+  computers:
+    - name: pc1
+`,
+		error: `line 8: drivers[0].aliases.inputs.02: alias [ps5] is already used for 01`,
+	}, {
+		name: "alias that hides a port",
+		config: `drivers:
+  - type: blustream
+    name: matrix
+    serial_device: /dev/ttyUSB0
+    aliases:
+      inputs:
+        "02": "01"
+layout:
+  computers:
+    - name: pc1
+`,
+		error: `line 7: drivers[0].aliases.inputs.02: alias [01] is the name of another port`,
+	}, {
+		name: "tcp without an address",
+		config: `drivers:
+  - type: blustream
+    name: matrix
+    transport: tcp
+layout:
+  computers:
+    - name: pc1
+`,
+		error: "line 2: drivers[0]: address is required when the transport is tcp",
+	}, {
+		name: "unknown transport",
+		config: `drivers:
+  - type: blustream
+    name: matrix
+    transport: usb
+    serial_device: /dev/ttyUSB0
+layout:
+  computers:
+    - name: pc1
+`,
+		error: "line 4: drivers[0].transport: transport must be one of: serial, tcp",
+	}}
+
+	for _, test := range tests {
+		_, err := parseConfig([]byte(test.config))
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.name)
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: expected %q in the error, got %q", test.name, test.error, err)
+		}
+	}
+}
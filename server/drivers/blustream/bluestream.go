@@ -1,12 +1,12 @@
 package blustream
 
 import (
-	"bytes"
-	"github.com/tarm/serial"
+	"encoding/json"
+	"fmt"
 	d "github.com/timgws/kvm-switch/server/drivers"
 	"log"
 	"regexp"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,10 +23,40 @@ const (
 	ReadingOutput
 )
 
-// BlustreamConfig holds the device-specific configuration.
-type BlustreamConfig struct {
-	SerialDevice string
-	SerialBaud int
+// DefaultConfig holds the settings that are used when they have not been configured.
+var DefaultConfig = d.Config{
+	ShortName: "matrix",
+	SerialBaud: 57600,
+	Timeout: 5 * time.Second,
+	InitDelay: 500 * time.Millisecond,
+	Inputs: 4,
+	Outputs: 4,
+}
+
+// prompt is what the matrix puts in front of the commands it echoes (eg, "CMX44AB> STATUS").
+var prompt = regexp.MustCompile(`^\w+> `)
+
+// newLineReader splits what the matrix sends into lines, without the prompt.
+func newLineReader(port d.Transport) *d.LineReader {
+	lines := d.NewLineReader(port)
+	lines.Prompt = prompt
+	return lines
+}
+
+// These are from the drivers package, as the driver methods use d for the driver (hiding the package).
+var (
+	openTransport    = d.OpenTransport
+	reconnect        = d.Reconnect
+	notifyConnection = d.NotifyConnection
+)
+
+func init() {
+	d.Register("blustream", func(config d.Config) (d.DriverInterface, error) {
+		if err := config.CheckTransport(); err != nil {
+			return nil, fmt.Errorf("blustream: %w", err)
+		}
+		return NewInstance(config), nil
+	})
 }
 
 // BlustreamInput represents a HDMI/DVI/USB-C input on a given Blustream matrix
@@ -60,7 +90,7 @@ type BlustreamMatrix struct {
 	*d.Driver
 	d.OutputMatrix
 
-	config BlustreamConfig
+	config d.Config
 	// isRunning defines whether we are connected to the rs232 port from the device, and it is working as expected.
 	isRunning bool
 
@@ -85,8 +115,12 @@ type BlustreamMatrix struct {
 	// serialResponse contains text that is coming inbound from the Blustream device.
 	serialResponse chan string
 
-	// finishedSwap makes sure that matrix swaps are synchronous
-	finishedSwap chan bool
+	// finishedSwap makes sure that matrix swaps are synchronous.
+	// It receives nil when the matrix confirms a swap, or the error if the command could not be sent.
+	finishedSwap chan error
+
+	// done is closed when the driver is shut down, to stop reading & writing to the device.
+	done chan struct{}
 
 	state           BlustreamState
 	switching       bool
@@ -95,10 +129,18 @@ type BlustreamMatrix struct {
 	statusConfirmed bool
 	statusStarted   bool
 	statusReading   Reading
+	// statusAsked is when STATUS was last sent. If the matrix does not reply, it is sent again after the timeout.
+	statusAsked time.Time
+	// statusRead is when the matrix last finished sending its status.
+	statusRead time.Time
 	modelSet        bool
 
-	// port contains the RS232 connection
-	port *serial.Port
+	// port is the connection to the device (RS232 or TCP)
+	port d.Transport
+
+	// lock guards the connection (port, isRunning, HasError & Error), the state of a swap, and Inputs & Outputs.
+	// They are read by the layout while the matrix's responses are being read into them.
+	lock sync.Mutex
 
 	// updatedInputs show inputs that have recently been updated (eg, new HDMI device coming online).
 	updatedInputs []int
@@ -111,17 +153,16 @@ type BlustreamMatrix struct {
 }
 
 // NewInstance create a new instance of a Blustream device.
-func NewInstance() *BlustreamMatrix {
+// Anything that has not been set in config will be taken from DefaultConfig.
+func NewInstance(config d.Config) *BlustreamMatrix {
+	config = config.WithDefaults(DefaultConfig)
 	return &BlustreamMatrix{
 		isRunning: false,
 		Driver: &d.Driver{
 			Name: "Blustream",
-			ShortName: "matrix",
-		},
-		config: BlustreamConfig{
-			SerialDevice: "/dev/tty.usbserial-141130",
-			SerialBaud: 57600,
+			ShortName: config.ShortName,
 		},
+		config: config,
 		state: BlustreamState{},
 	}
 }
@@ -137,280 +178,490 @@ func (d *BlustreamMatrix) GetShortName() string {
 }
 
 func (d *BlustreamMatrix) DriverName() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	return d.Name
 }
 
 // IsRunning will show if the device is being read from or not.
 func (d *BlustreamMatrix) IsRunning() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	return d.isRunning
 }
 
 // Start initializes the connection, sends first status command.
+// If the matrix can't be opened, the driver keeps trying to connect to it in the background.
 func (d *BlustreamMatrix) Start() bool {
 	d.StartAttempted = true
-	s_dev := d.config.SerialDevice
-	s_baud := d.config.SerialBaud
+	d.done = make(chan struct{})
+	d.messages = make(chan string)
+	d.serialResponse = make(chan string)
+	d.finishedSwap = make(chan error, 1)
+
+	go d.processResponses()
 
-	c := &serial.Config{Name: s_dev, Baud: s_baud}
-	s, err := serial.OpenPort(c)
+	go d.writePort()
+
+	s, err := openTransport(d.config)
 	if err != nil {
-		d.Error = err
+		d.setError(err)
+		go d.reconnect()
 		return false
 	}
 
-	d.port = s
+	d.connected(s)
+	return true
+}
 
-	go d.readPort()
-	go d.init()
+// connected starts reading from a connection that has just been opened, and asks the matrix for its status.
+// It returns false (closing the connection) if the driver was shut down while the matrix was being opened.
+func (d *BlustreamMatrix) connected(port d.Transport) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.stopped() {
+		port.Close()
+		return false
+	}
 
-	//go d.pingStatus(s)
+	d.port = port
+	d.HasError = false
+	d.Error = nil
+	d.isRunning = true
 
-	go d.processResponses()
+	go d.readPort(port)
+	go d.init(port)
+	return true
+}
+
+// disconnected closes a connection that has failed (eg, the USB serial adapter was unplugged), and starts
+// trying to reconnect.
+func (d *BlustreamMatrix) disconnected(port d.Transport, err error) {
+	d.lock.Lock()
+	if d.stopped() {
+		// Shutdown has closed the port, which is why reading from it failed.
+		d.lock.Unlock()
+		return
+	}
+	d.isRunning = false
+	d.HasError = true
+	d.Error = err
+	d.port = nil
+	d.lock.Unlock()
+
+	log.Printf("[blustream]: Lost the connection to %s: %s", d.config.Connection(), err)
+	port.Close()
+
+	notifyConnection(d.ShortName, err)
+	go d.reconnect()
+}
+
+// reconnect opens the matrix again (waiting longer between each attempt), then reads its status.
+func (d *BlustreamMatrix) reconnect() {
+	port := reconnect(d.config, d.done)
+	if port == nil {
+		return
+	}
+
+	if d.connected(port) {
+		notifyConnection(d.ShortName, nil)
+	}
+}
+
+// Shutdown stops talking to the matrix, and closes the serial port.
+func (d *BlustreamMatrix) Shutdown() bool {
+	d.lock.Lock()
+	if d.done == nil || d.stopped() {
+		d.lock.Unlock()
+		return false
+	}
 
-	go d.writePort(s)
+	close(d.done)
+	d.isRunning = false
+	port := d.port
+	d.port = nil
+	d.lock.Unlock()
 
+	if port == nil {
+		return true
+	}
+	if err := port.Close(); err != nil {
+		d.lock.Lock()
+		d.Error = err
+		d.lock.Unlock()
+		return false
+	}
 	return true
 }
 
+// stopped checks if the driver has been shut down.
+func (d *BlustreamMatrix) stopped() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// setError records that talking to the matrix has failed.
+func (d *BlustreamMatrix) setError(err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.HasError = true
+	d.Error = err
+}
+
 // GetStatus ask the Blustream matrix what the current state of the device is.
 // Call me to see if devices have changes (without notifying the switch)
+// The status is read in the background, so InputActive & CurrentInput show the changes once it has been read.
+// Nothing is sent while the matrix is still sending the last status.
 func (d *BlustreamMatrix) GetStatus() {
-	d.pingStatus()
+	d.lock.Lock()
+	reading := d.statusIncoming || d.statusReading > NotReadingStatus
+	if d.port == nil || (reading && time.Since(d.statusAsked) < d.config.Timeout) {
+		d.lock.Unlock()
+		return
+	}
+	d.statusIncoming = true
+	d.statusAsked = time.Now()
+	d.lock.Unlock()
+
+	select {
+	case d.messages <- "STATUS":
+	case <-d.done:
+	}
+}
+
+// StatusRead returns when the matrix last finished sending its status.
+func (d *BlustreamMatrix) StatusRead() time.Time {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.statusRead
 }
 
 // SetOutput will change the output of a port to the given input port.
-func (d *BlustreamMatrix) SetOutput(outputName string, inputName string) {
-	if d.switching {
-		return
+// It waits for the matrix to confirm the swap, returning an error if it does not.
+func (d *BlustreamMatrix) SetOutput(outputName string, inputName string) error {
+	if err := d.startSwitching(outputName, inputName); err != nil {
+		return err
 	}
-	debugLog("OUTPUT MATRIX %s -> %s", outputName, inputName)
+	defer func() {
+		d.lock.Lock()
+		d.switching = false
+		d.lock.Unlock()
+	}()
 
-	d.finishedSwap = make(chan bool)
+	select {
+	case d.messages <- "OUT" + outputName + "FR" + inputName:
+	case <-d.done:
+		return fmt.Errorf("%s has been shut down", d.ShortName)
+	}
 
-	var matrixOutput *BlustreamOutput
-	var matrixInput *BlustreamInput
+	select {
+	case err := <-d.finishedSwap:
+		return err
+	case <-time.After(d.config.Timeout):
+		log.Printf("[blustream]: Timed out waiting for output %s to swap to input %s", outputName, inputName)
+		return fmt.Errorf("timed out waiting for %s to swap output %s to input %s", d.ShortName, outputName, inputName)
+	}
+}
 
-	debugLog("Out/In: %s, %s", d.Outputs, d.Inputs)
+// startSwitching checks that an output can be swapped, and marks the matrix as switching.
+func (d *BlustreamMatrix) startSwitching(outputName string, inputName string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 
-	for i, output := range d.Outputs {
-		if output.OutputName == outputName {
-			debugLog("<- OUTPUT %s == %s", output.OutputName, outputName)
-			matrixOutput = &d.Outputs[i]
-		}
+	if d.port == nil {
+		return fmt.Errorf("%s is not connected", d.ShortName)
 	}
-	for i, input := range d.Inputs {
-		if input.InputName == inputName {
-			debugLog("<- INPUT %s == %s", input.InputName, inputName)
-			matrixInput = &d.Inputs[i]
-		}
+	if d.switching {
+		return fmt.Errorf("%s is already switching an output", d.ShortName)
 	}
+	debugLog("OUTPUT MATRIX %s -> %s", outputName, inputName)
 
-	if matrixInput != nil && matrixOutput != nil {
-		if !d.switching {
-			d.switching = true
-			d.messages <- "OUT" + outputName + "FR" + inputName
-		}
+	if !d.hasPorts(outputName, inputName) {
+		debugLog("Output %s or input %s does not exist, not swapping", outputName, inputName)
+		return fmt.Errorf("%s does not have output %s or input %s", d.ShortName, outputName, inputName)
 	}
 
+	// Throw away a confirmation that arrived after an earlier swap timed out.
 	select {
-	case _, ok := <-d.finishedSwap:
-		if ok {
-			return
-		}
+	case <-d.finishedSwap:
+	default:
 	}
+	d.switching = true
+	return nil
 }
 
 // init the device.
-func (d *BlustreamMatrix) init() {
-	port := d.port
+func (d *BlustreamMatrix) init(port d.Transport) {
 	// We are going to ask the device for the current status.
-	time.Sleep(time.Millisecond * 500)
+	time.Sleep(d.config.InitDelay)
+	d.lock.Lock()
 	d.statusIncoming = true
 	d.statusReading = ReadingModel
-	n, err := port.Write([]byte("STATUS\r\n"))
-	if err != nil {
-		d.statusReading = WaitingInput
-		d.Error = err
-		d.HasError = true
-		debugLog("Could not send %d bytes for driver.", n)
-	}
+	d.statusAsked = time.Now()
+	d.lock.Unlock()
+	// Flushed first, so the STATUS command is not thrown away before it is sent.
 	port.Flush()
-}
-
-// init the device.
-func (d *BlustreamMatrix) pingStatus() {
-	port := d.port
-	// We are going to ask the device for the current status.
-	time.Sleep(time.Millisecond * 500)
-	d.statusIncoming = true
 	n, err := port.Write([]byte("STATUS\r\n"))
 	if err != nil {
+		d.lock.Lock()
 		d.statusReading = WaitingInput
-		d.Error = err
-		d.HasError = true
+		d.lock.Unlock()
+		d.setError(err)
 		debugLog("Could not send %d bytes for driver.", n)
 	}
-	port.Flush()
 }
 
 
-// writePort manages a channel that allows us to send & receive data to this serial connection.
-func (d *BlustreamMatrix) writePort(port *serial.Port) {
-	d.messages = make(chan string)
 
+
+// writePort manages a channel that allows us to send & receive data to this serial connection.
+func (d *BlustreamMatrix) writePort() {
 	go func() {
 		for {
 			select {
+			case <-d.done:
+				return
 			case msg := <-d.messages:
 				debugLog("==> WRITE PORT MSG: %s", msg)
+				d.lock.Lock()
+				port := d.port
+				d.lock.Unlock()
+				if port == nil {
+					d.finishSwap(fmt.Errorf("%s is not connected", d.ShortName))
+					continue
+				}
 				n, err := port.Write([]byte(msg + "\r\n"))
 				if err != nil {
 					debugLog("Error writing %d bytes: %s", n, err)
-					d.HasError = true
-					d.Error = err
+					d.setError(err)
+					d.finishSwap(err)
 				}
 			}
 		}
 	}()
 }
 
-// readPort continuously reads data from the serial port, checks if there is some new data received
-// and sends it down to the serialResponse channel when we are g2g with a response from a command.
-//
-// TODO: This needs a big refactor. It's a little dodgy, but it does the trick.
-func (d *BlustreamMatrix) readPort() {
-	port := *d.port
-	var command string
+// readPort reads lines from the matrix, and sends them down to the serialResponse channel.
+// If the connection fails, the driver starts trying to reconnect.
+func (d *BlustreamMatrix) readPort(port d.Transport) {
+	lines := newLineReader(port)
 	for {
-		buf := make([]byte, 820)
-		n, err := port.Read(buf)
+		line, err := lines.ReadLine()
 		if err != nil {
-			log.Fatal(n, err)
+			d.disconnected(port, err)
+			return
 		}
 
-
-		b := bytes.Trim(buf, "\x00")
-		tmpString := string(b)
-		command = command + tmpString
-
-		commands := strings.Split(command, "\r\n")
-
-		numCommands := len(commands)
-		if numCommands > 1 {
-			for i := range commands {
-				// if we are at the last command, check that we have an empty command...
-				if i == numCommands-1 {
-					if commands[i] == "" {
-						buf = []byte("")
-						debugLog("BUFFER: %s %q", buf, buf)
-						continue
-					}
-				} else if i != numCommands {
-					currentCommand := commands[0]
-					if len(commands) > 1 {
-						numCommands--
-						commands = commands[1:]
-
-						//buf = []byte(string(commands.joi))
-						command = strings.Join(commands, "\r\n")
-						buf = []byte(command)
-					}
-
-					d.serialResponse <- currentCommand
-
-					debugLog("==> Command #%d/%d: %s", i+1, len(commands), currentCommand)
-				}
-			}
-
-			if EnableDebugMode == false{
-				debugLog2("🧐 Inspecting the buffer contents")
-				debugLog2("BUFFER CONTENTS: %s tmpString: %s", buf, tmpString)
-				debugLog2("commands: %s - %q", commands, buf)
-			}
-		} else {
-			//debugLog("Incomplete command from serial... expected newline")
+		debugLog("==> Line: %q", line)
+		select {
+		case d.serialResponse <- line:
+		case <-d.done:
+			return
 		}
 	}
 }
 
 // processResponses reads serial commands that have been fully read from the serial connection.
 func (d *BlustreamMatrix) processResponses() {
-	d.serialResponse = make(chan string)
-
 	go func() {
 		for {
 			select {
+			case <-d.done:
+				return
 			case msg := <-d.serialResponse:
 				debugLog("<== READ SERIAL COMMAND: %s %q", msg, msg)
+				d.lock.Lock()
+				d.processResponse(msg)
+				d.lock.Unlock()
+			}
+		}
+	}()
+}
 
-				// Sometimes the output contains the model name. Hope we have it!
-				if strings.Contains(msg, "> ") && len(d.state.ModelName) > 0 {
-					s := strings.SplitN(msg, "> ", 2)
-					if s[0] == d.state.ModelName {
-						msg = strings.Join(s[1:], "> ")
-					}
-				}
+// processResponse handles a single line from the matrix. d.lock must be held.
+func (d *BlustreamMatrix) processResponse(msg string) {
+	// NOTE status-response.txt to see what we are parsing.
+	// If we see that the STATUS command is incoming, then we need to hold some state:
+	if d.statusIncoming && msg == "STATUS" {
+		// State 1: starting to read the status, but the command itself has not started to be received.
+		// State 2: skip normal command processing, and parse the status command.
+		// State 3: Finished reading the status command, go back to reading the command output as normal.
+		debugLog("🍔 Eating the status command from Blustream")
+		// Here we enter state 1.
+		d.statusReading = ReadingModel
+		d.statusStarted = true // get ready for state 2.
+		d.statusIncoming = false
+		return
+	}
 
-				// NOTE status-response.txt to see what we are parsing.
-				// If we see that the STATUS command is incoming, then we need to hold some state:
-				if d.statusIncoming && msg == "STATUS" {
-					// State 1: starting to read the status, but the command itself has not started to be received.
-					// State 2: skip normal command processing, and parse the status command.
-					// State 3: Finished reading the status command, go back to reading the command output as normal.
-					debugLog("🍔 Eating the status command from Blustream")
-					// Here we enter state 1.
-					d.statusReading = ReadingModel
-					d.statusStarted = true // get ready for state 2.
-					d.statusIncoming = false
-				} else if d.statusReading > NotReadingStatus && len(msg) > 2 {
-					if msg[:2] == "==" {
-						// for the first set of "==", we need to stay in the status incoming state.
-						// for the second, we can leave this special state.
-						if d.statusStarted {
-							// Here we enter state 2.
-							debugLog("🥇 The next line of should be the start of our statuses.")
-							d.statusStarted = false
-							continue
-						}
-
-						// Here we enter state 3.
-						debugLog("🥇 We have finished reading the status.")
-						d.statusStarted = true
-						d.statusReading = NotReadingStatus // leave our status state
-						continue
-					}
-
-					debugLog("😰 Status confirmed. Should it be?")
-					d.readStatus(msg)
-					continue
-				}
+	if d.statusReading > NotReadingStatus && len(msg) > 2 {
+		if msg[:2] == "==" {
+			// for the first set of "==", we need to stay in the status incoming state.
+			// for the second, we can leave this special state.
+			if d.statusStarted {
+				// Here we enter state 2.
+				debugLog("🥇 The next line of should be the start of our statuses.")
+				d.statusStarted = false
+				return
+			}
 
-				if len(msg) > 10 {
-					// [SUCCESS]Set output 01 connect from input 02.
-					if msg[:9] == "[SUCCESS]" {
-						//match := []byte(msg[9:])
-						r, _ := regexp.Compile(`Set output (\d*) connect from input (\d*)`)
-						f := r.FindAllStringSubmatch(msg[9:], 12)
-						if len(f[0]) == 3 {
-							debugLog("Swapped input %s to output %s", f[0][2], f[0][1])
-						}
-						d.finishedSwap <- true
-						d.switching = false
-						d.switched = true
-					}
-				}
+			// Here we enter state 3.
+			debugLog("🥇 We have finished reading the status.")
+			d.statusStarted = true
+			d.statusReading = NotReadingStatus // leave our status state
+			d.statusRead = time.Now()
+			return
+		}
+
+		debugLog("😰 Status confirmed. Should it be?")
+		d.readStatus(msg)
+		return
+	}
+
+	if len(msg) > 10 {
+		// [SUCCESS]Set output 01 connect from input 02.
+		if msg[:9] == "[SUCCESS]" {
+			//match := []byte(msg[9:])
+			r, _ := regexp.Compile(`Set output (\d*) connect from input (\d*)`)
+			f := r.FindAllStringSubmatch(msg[9:], 12)
+			if len(f) > 0 && len(f[0]) == 3 {
+				debugLog("Swapped input %s to output %s", f[0][2], f[0][1])
+				d.setRoute(f[0][1], f[0][2])
 			}
+			d.finishSwap(nil)
+			d.switching = false
+			d.switched = true
 		}
-	}()
+	}
+}
+
+// finishSwap lets SetOutput know that a swap has finished (if anything is waiting for one).
+func (d *BlustreamMatrix) finishSwap(err error) {
+	select {
+	case d.finishedSwap <- err:
+	default:
+	}
+}
+
+// CurrentInput returns the name of the input that an output is showing, if it is known.
+func (d *BlustreamMatrix) CurrentInput(outputName string) (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, output := range d.Outputs {
+		if output.OutputName != outputName {
+			continue
+		}
+		if input, ok := output.Input.(*BlustreamInput); ok && input != nil {
+			return input.InputName, true
+		}
+	}
+	return "", false
+}
+
+// setRoute records that an output is now showing an input. d.lock must be held.
+func (d *BlustreamMatrix) setRoute(outputName string, inputName string) {
+	input := d.input(inputName)
+	if input == nil {
+		return
+	}
+
+	for _, output := range d.Outputs {
+		if output.OutputName == outputName {
+			output.Input = input
+		}
+	}
+}
+
+// hasPorts checks that the matrix has reported both an output and an input. d.lock must be held.
+func (d *BlustreamMatrix) hasPorts(outputName string, inputName string) bool {
+	hasOutput := false
+	for _, output := range d.Outputs {
+		if output.OutputName == outputName {
+			hasOutput = true
+		}
+	}
+	return hasOutput && d.input(inputName) != nil
+}
+
+// InputNames returns the names of the inputs on the matrix.
+// Until the matrix has reported its status, the names are guessed from the configured number of inputs.
+func (d *BlustreamMatrix) InputNames() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.Inputs) == 0 {
+		return portNames(d.config.Inputs)
+	}
+
+	var names []string
+	for _, input := range d.Inputs {
+		names = append(names, input.InputName)
+	}
+	return names
+}
+
+// OutputNames returns the names of the outputs on the matrix.
+// Until the matrix has reported its status, the names are guessed from the configured number of outputs.
+func (d *BlustreamMatrix) OutputNames() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.Outputs) == 0 {
+		return portNames(d.config.Outputs)
+	}
+
+	var names []string
+	for _, output := range d.Outputs {
+		names = append(names, output.OutputName)
+	}
+	return names
+}
+
+// portNames creates port names the same way the matrix names them (01, 02, ...)
+func portNames(count int) []string {
+	var names []string
+	for i := 1; i <= count; i++ {
+		names = append(names, fmt.Sprintf("%02d", i))
+	}
+	return names
+}
+
+// MarshalJSON locks the driver, so that /driverStatus does not read it while it is being updated.
+func (d *BlustreamMatrix) MarshalJSON() ([]byte, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// matrix does not have this method, so json does not call it again.
+	type matrix BlustreamMatrix
+	return json.Marshal((*matrix)(d))
+}
+
+// Config returns the configuration that the matrix was created with.
+func (d *BlustreamMatrix) Config() d.Config {
+	return d.config
 }
 
 // LastError return the last
 func (d *BlustreamMatrix) LastError() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	return d.Error
 }
 
 // GetInput will return an input with a given name
 func (d *BlustreamMatrix) GetInput(inputName string) *BlustreamInput {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.input(inputName)
+}
+
+// input finds an input by its name. d.lock must be held.
+func (d *BlustreamMatrix) input(inputName string) *BlustreamInput {
 	for _, input := range d.Inputs {
 		if input.InputName == inputName {
 			return &input
@@ -419,6 +670,18 @@ func (d *BlustreamMatrix) GetInput(inputName string) *BlustreamInput {
 	return nil
 }
 
+// InputActive checks if the matrix has reported a source on an input (from the last STATUS).
+func (d *BlustreamMatrix) InputActive(inputName string) (bool, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	input := d.input(inputName)
+	if input == nil || input.Input == nil {
+		return false, false
+	}
+	return input.Active, true
+}
+
 // debugLog will output something only if EnableDebugMode is true.
 func debugLog(msg string, v ...interface{}) {
 	if EnableDebugMode {
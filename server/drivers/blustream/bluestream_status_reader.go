@@ -8,6 +8,7 @@ import (
 )
 
 // readStatus will read each line from the serial console after the `status` command is issued.
+// d.lock must be held, as the inputs & outputs are updated.
 func (d *BlustreamMatrix) readStatus(_msg string) {
 	msg := strings.TrimSpace(_msg)
 
@@ -138,6 +139,7 @@ func (d *BlustreamMatrix) readInputLine(res []string) {
 				newInput := BlustreamInput{
 					Input: &drivers.Input{
 						InputName: res[0],
+						Alias:     d.config.Aliases.Inputs[res[0]],
 						Active:    isActive(res[2]),
 					},
 					Edid:  res[1],
@@ -187,10 +189,11 @@ func (d *BlustreamMatrix) readOutputLine(res []string) {
 
 			if d.NumOfOutputs < d.state.readingOutputNumber {
 				d.state.readingOutputNumber++
-				input := d.GetInput(res[1])
+				input := d.input(res[1])
 				newOutput := BlustreamOutput{
 					Output: &drivers.Output{
 						OutputName: res[0],
+						Alias: d.config.Aliases.Outputs[res[0]],
 						Active: isActive(res[2]) && isActive(res[3]),
 						Input: input,
 					},
@@ -214,6 +217,10 @@ func (d *BlustreamMatrix) readOutputLine(res []string) {
 							output.Edid = res[1]
 						}
 
+						if input := d.input(res[1]); input != nil {
+							output.Input = input
+						}
+
 						if updatedInput {
 							log.Println(output.OutputName, "has changed")
 							d.updatedInputs = append(d.updatedInputs, k)
@@ -0,0 +1,179 @@
+package blustream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	d "github.com/timgws/kvm-switch/server/drivers"
+	"github.com/timgws/kvm-switch/server/emulator"
+)
+
+// startEmulated starts a driver that is connected to an emulated matrix over TCP, waiting for it to read the status.
+func startEmulated(t *testing.T, matrix *emulator.Blustream, outputs int) *BlustreamMatrix {
+	listener, err := emulator.Listen(matrix, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	driver := NewInstance(d.Config{
+		Transport: d.TransportTCP,
+		Address:   listener.Addr().String(),
+		Timeout:   time.Second,
+		InitDelay: time.Millisecond,
+	})
+	if !driver.Start() {
+		t.Fatalf("Could not start the driver: %s", driver.LastError())
+	}
+	t.Cleanup(func() { driver.Shutdown() })
+
+	waitForStatus(t, driver, outputs)
+	return driver
+}
+
+// waitForStatus waits for the driver to know what the last output of the matrix is showing.
+func waitForStatus(t *testing.T, driver *BlustreamMatrix, outputs int) {
+	t.Helper()
+	last := fmt.Sprintf("%02d", outputs)
+	for wait := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, known := driver.CurrentInput(last); known {
+			return
+		}
+		if time.Since(wait) > 2*time.Second {
+			t.Fatal("The driver did not read the status of the matrix")
+		}
+	}
+}
+
+func TestDriverReadsStatusFromEmulator(t *testing.T) {
+	matrix := emulator.NewBlustream(8, 8)
+	matrix.SetConnected(3, false)
+	driver := startEmulated(t, matrix, 8)
+
+	if driver.DriverName() != "Blustream CMX88AB v2.22" {
+		t.Errorf("Expected the model to be read from the status, got %s", driver.DriverName())
+	}
+	if len(driver.InputNames()) != 8 || len(driver.OutputNames()) != 8 {
+		t.Errorf("Expected 8 inputs and outputs, got %v and %v", driver.InputNames(), driver.OutputNames())
+	}
+	if input, known := driver.CurrentInput("05"); !known || input != "05" {
+		t.Errorf("Expected output 05 to be showing input 05, got %s (known: %t)", input, known)
+	}
+	if active, known := driver.InputActive("03"); !known || active {
+		t.Errorf("Expected input 03 to not have a source, got active: %t (known: %t)", active, known)
+	}
+	if active, _ := driver.InputActive("04"); !active {
+		t.Error("Expected input 04 to have a source")
+	}
+	if status, err := json.Marshal(driver); err != nil || !strings.Contains(string(status), `"HasError":false`) {
+		t.Errorf("Expected the status of the driver to be shown, got %s (error: %v)", status, err)
+	}
+}
+
+func TestDriverSwapsOutputOnEmulator(t *testing.T) {
+	matrix := emulator.NewBlustream(4, 4)
+	driver := startEmulated(t, matrix, 4)
+
+	if err := driver.SetOutput("01", "03"); err != nil {
+		t.Fatalf("Could not swap output 01: %s", err)
+	}
+	if matrix.Route(1) != 3 {
+		t.Errorf("Expected the matrix to show input 3 on output 1, got %d", matrix.Route(1))
+	}
+	if input, _ := driver.CurrentInput("01"); input != "03" {
+		t.Errorf("Expected the driver to know output 01 is showing input 03, got %s", input)
+	}
+
+	if err := driver.SetOutput("01", "09"); err == nil {
+		t.Error("Expected swapping to an input that does not exist to fail")
+	}
+}
+
+func TestDriverReconnectsToEmulator(t *testing.T) {
+	matrix := emulator.NewBlustream(4, 4)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// Each connection is handed to the test, so it can be dropped like an unplugged adapter.
+	connections := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connections <- conn
+			go emulator.Serve(matrix, conn)
+		}
+	}()
+
+	events := make(chan d.Event, 4)
+	d.OnEvent(func(event d.Event) {
+		// Handlers can not be removed, so this one must not block once the test is over (eg, with -count).
+		if event.Driver != "reconnecting-matrix" {
+			return
+		}
+		select {
+		case events <- event:
+		default:
+		}
+	})
+
+	driver := NewInstance(d.Config{
+		ShortName:      "reconnecting-matrix",
+		Transport:      d.TransportTCP,
+		Address:        listener.Addr().String(),
+		Timeout:        time.Second,
+		InitDelay:      time.Millisecond,
+		ReconnectDelay: 10 * time.Millisecond,
+	})
+	if !driver.Start() {
+		t.Fatalf("Could not start the driver: %s", driver.LastError())
+	}
+	defer driver.Shutdown()
+
+	(<-connections).Close()
+	for _, expected := range []d.ConnectionState{d.Disconnected, d.Connected} {
+		select {
+		case event := <-events:
+			if event.State != expected {
+				t.Fatalf("Expected the driver to be %s, got %+v", expected, event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for the driver to be %s", expected)
+		}
+	}
+	<-connections
+
+	if !driver.IsRunning() || driver.LastError() != nil {
+		t.Errorf("Expected the driver to be running again, got running: %t, error: %v", driver.IsRunning(), driver.LastError())
+	}
+	waitForStatus(t, driver, 4)
+	if err := driver.SetOutput("02", "04"); err != nil {
+		t.Errorf("Could not swap after reconnecting: %s", err)
+	}
+}
+
+func TestDriverRefreshesStatusFromEmulator(t *testing.T) {
+	matrix := emulator.NewBlustream(4, 4)
+	driver := startEmulated(t, matrix, 4)
+	read := driver.StatusRead()
+
+	matrix.SetConnected(2, false)
+	driver.GetStatus()
+	for wait := time.Now(); !driver.StatusRead().After(read); time.Sleep(10 * time.Millisecond) {
+		if time.Since(wait) > 2*time.Second {
+			t.Fatal("The driver did not read the status again")
+		}
+	}
+	if active, known := driver.InputActive("02"); !known || active {
+		t.Errorf("Expected input 02 to not have a source once the status was read again, got active: %t (known: %t)", active, known)
+	}
+}
@@ -0,0 +1,92 @@
+package drivers
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultReconnectDelay is how long a driver waits before it first tries to reconnect, when it has not been configured.
+const defaultReconnectDelay = time.Second
+
+// maxReconnectDelay is the longest a driver waits between attempts to reconnect.
+const maxReconnectDelay = 30 * time.Second
+
+// ConnectionState is whether a driver can talk to its device.
+type ConnectionState string
+
+const (
+	// Connected means the device has been (re)opened, and the driver has started talking to it again.
+	Connected ConnectionState = "connected"
+	// Disconnected means the connection failed (eg, the USB serial adapter was unplugged), and the driver is retrying.
+	Disconnected ConnectionState = "disconnected"
+)
+
+// Event is sent when a driver loses, or gets back, the connection to its device.
+type Event struct {
+	Driver string          `json:"driver"`
+	State  ConnectionState `json:"state"`
+	Error  string          `json:"error,omitempty"`
+}
+
+var eventsLock sync.Mutex
+var eventHandlers []func(Event)
+
+// OnEvent calls handler for every event that a driver sends.
+func OnEvent(handler func(Event)) {
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+	eventHandlers = append(eventHandlers, handler)
+}
+
+// Notify sends an event to everything that is listening for them.
+func Notify(event Event) {
+	eventsLock.Lock()
+	handlers := make([]func(Event), len(eventHandlers))
+	copy(handlers, eventHandlers)
+	eventsLock.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// NotifyConnection tells everything listening for events that a driver has been disconnected by err, or has connected
+// again (when err is nil).
+func NotifyConnection(driver string, err error) {
+	event := Event{Driver: driver, State: Connected}
+	if err != nil {
+		event.State = Disconnected
+		event.Error = err.Error()
+	}
+	Notify(event)
+}
+
+// Reconnect opens the driver's transport again, waiting longer between each attempt (up to maxReconnectDelay).
+// It gives up, returning nil, when done is closed.
+func Reconnect(config Config, done <-chan struct{}) Transport {
+	delay := config.ReconnectDelay
+	if delay <= 0 {
+		delay = defaultReconnectDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-done:
+			return nil
+		case <-time.After(delay):
+		}
+
+		port, err := OpenTransport(config)
+		if err == nil {
+			log.Printf("[%s]: Reconnected to %s after %d attempt(s)", config.ShortName, config.Connection(), attempt)
+			return port
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+		log.Printf("[%s]: Could not reconnect to %s (attempt %d, trying again in %s): %s", config.ShortName, config.Connection(), attempt, delay, err)
+	}
+}
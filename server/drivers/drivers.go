@@ -1,5 +1,7 @@
 package drivers
 
+import "time"
+
 type Driver struct {
 	DriverInterface
 	Name string
@@ -12,12 +14,16 @@ type Driver struct {
 type Input struct {
 	DriverInput
 	InputName string
+	// Alias is the friendly name of the input (if one has been configured).
+	Alias string `json:",omitempty"`
 	Active bool
 }
 
 type Output struct {
 	DriverOutput
 	OutputName string
+	// Alias is the friendly name of the output (if one has been configured).
+	Alias string `json:",omitempty"`
 	Active bool
 	Input DriverInput
 }
@@ -40,7 +46,8 @@ type DriverInterface interface {
 
 	// SupportsInitState determines if a driver supports telling us about the state of the controlling device.
 	// If we support knowing the state, we will query it and update our own state about the device.
-	// If the device/driver does not implement querying state, we will simply reset all devices to the initial state.
+	// If the device/driver does not implement querying state, we will simply reset all devices to the initial state
+	// (by performing the layout's home_scene for them).
 	SupportsInitState() bool
 
 	// Start running a driver. Attempt to Dial the device, and determine the state (if possible)
@@ -56,10 +63,49 @@ type DriverInterface interface {
 	IsMatrix() bool
 }
 
+// PortLister is implemented by drivers that know the names of the inputs & outputs on their device.
+type PortLister interface {
+	InputNames() []string
+	OutputNames() []string
+}
+
+// MatrixState is implemented by matrix drivers that know which input each output is showing.
+type MatrixState interface {
+	CurrentInput(outputName string) (inputName string, known bool)
+}
+
+// SingleState is implemented by drivers with a single output that know which input is selected.
+type SingleState interface {
+	CurrentInput() (inputName string, known bool)
+}
+
+// InputStatus is implemented by drivers that know if a source is connected to an input (and sending a signal).
+type InputStatus interface {
+	InputActive(inputName string) (active bool, known bool)
+}
+
+// StatusReader is implemented by drivers that read their status in the background after GetStatus, so that the
+// layout can wait for a fresh status.
+type StatusReader interface {
+	// StatusRead is when the device last finished sending its status.
+	StatusRead() time.Time
+}
+
+// OutputMatrix is implemented by drivers that can route any input to any of their outputs.
+// SetOutput returns an error if the device did not confirm the swap.
 type OutputMatrix interface {
-	SetOutput(outputName string, inputName string)
+	SetOutput(outputName string, inputName string) error
 }
 
+// OutputSingle is implemented by drivers with one output (eg, a KVM).
+// SetOutput returns an error if the device did not confirm the swap.
 type OutputSingle interface {
-	SetOutput(inputName string)
-}
\ No newline at end of file
+	SetOutput(inputName string) error
+}
+
+// LayeredOutput is implemented by matrix drivers that can switch video, audio or USB separately.
+// The output is "" for drivers with a single output.
+type LayeredOutput interface {
+	Layers() []string
+	SetLayerOutput(layer string, outputName string, inputName string) error
+}
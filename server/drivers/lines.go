@@ -0,0 +1,100 @@
+package drivers
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// readChunkSize is how much is read from the device at a time.
+const readChunkSize = 256
+
+// LineReader splits what a device sends into lines. Devices send a response in pieces (a serial port might only give
+// us a few bytes at a time), or send several lines at once, so lines are buffered until a terminator is read.
+type LineReader struct {
+	reader io.Reader
+
+	// Terminators end a line (eg, "\r\n"). When more than one could end a line, the one found first is used.
+	Terminators []string
+
+	// Prompt is removed from the start of each line (eg, "CMX44AB> " before the device echoes a command).
+	// Lines that were only a prompt are skipped.
+	Prompt *regexp.Regexp
+
+	buffer string
+	lines  []string
+}
+
+// NewLineReader creates a LineReader that reads from a device, splitting lines on "\r\n" unless terminators are given.
+func NewLineReader(reader io.Reader, terminators ...string) *LineReader {
+	if len(terminators) == 0 {
+		terminators = []string{"\r\n"}
+	}
+	return &LineReader{reader: reader, Terminators: terminators}
+}
+
+// ReadLine returns the next line from the device, without its terminator (or prompt).
+// Errors from the device are returned as they are; anything that was read without a terminator is kept, in case
+// reading is tried again.
+func (l *LineReader) ReadLine() (string, error) {
+	buf := make([]byte, readChunkSize)
+	for len(l.lines) == 0 {
+		n, err := l.reader.Read(buf)
+		if n > 0 {
+			// Some devices pad what they send with NULs.
+			l.buffer += strings.ReplaceAll(string(buf[:n]), "\x00", "")
+			l.split(false)
+		}
+		if err != nil {
+			// Nothing else is coming for now, so a terminator that was being held back ends its line.
+			l.split(true)
+			if len(l.lines) == 0 {
+				return "", err
+			}
+		}
+	}
+
+	line := l.lines[0]
+	l.lines = l.lines[1:]
+	return line, nil
+}
+
+// split moves every complete line out of the buffer.
+// A terminator at the very end of the buffer that could be the start of a longer one (eg, "\r" before the "\n" of
+// "\r\n" has been read) is held back until more is read, unless final is set.
+func (l *LineReader) split(final bool) {
+	for {
+		end, length := -1, 0
+		for _, terminator := range l.Terminators {
+			i := strings.Index(l.buffer, terminator)
+			if i >= 0 && (end < 0 || i < end || (i == end && len(terminator) > length)) {
+				end, length = i, len(terminator)
+			}
+		}
+		if end < 0 || (!final && end+length == len(l.buffer) && l.couldContinue(l.buffer[end:])) {
+			return
+		}
+
+		line := l.buffer[:end]
+		l.buffer = l.buffer[end+length:]
+		if l.Prompt != nil {
+			if prompt := l.Prompt.FindStringIndex(line); prompt != nil && prompt[0] == 0 {
+				line = line[prompt[1]:]
+				if line == "" {
+					continue
+				}
+			}
+		}
+		l.lines = append(l.lines, line)
+	}
+}
+
+// couldContinue checks if terminator is the start of a longer terminator.
+func (l *LineReader) couldContinue(terminator string) bool {
+	for _, longer := range l.Terminators {
+		if len(longer) > len(terminator) && strings.HasPrefix(longer, terminator) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package drivers
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// chunkedReader gives back each chunk from a separate Read, the same way a serial port does.
+type chunkedReader struct {
+	chunks []string
+	err    error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, c.err
+	}
+	n := copy(p, c.chunks[0])
+	c.chunks = c.chunks[1:]
+	return n, nil
+}
+
+func TestLineReader(t *testing.T) {
+	prompt := regexp.MustCompile(`^\w+> `)
+	readErr := errors.New("device unplugged")
+
+	tests := []struct {
+		name        string
+		chunks      []string
+		terminators []string
+		prompt      *regexp.Regexp
+		err         error
+		lines       []string
+	}{{
+		name:   "one line",
+		chunks: []string{"CH2\r\n"},
+		lines:  []string{"CH2"},
+	}, {
+		name:   "partial reads",
+		chunks: []string{"[SUC", "CESS]Set output 01 ", "connect from input 02.\r", "\n"},
+		lines:  []string{"[SUCCESS]Set output 01 connect from input 02."},
+	}, {
+		name:   "several lines in one chunk",
+		chunks: []string{"ERROR\r\nCH1\r\nCH", "3\r\n"},
+		lines:  []string{"ERROR", "CH1", "CH3"},
+	}, {
+		name:   "empty lines are kept",
+		chunks: []string{"Input\r\n\r\nOutput\r\n"},
+		lines:  []string{"Input", "", "Output"},
+	}, {
+		name:   "nul padding",
+		chunks: []string{"CH1\x00\x00\r\n\x00"},
+		lines:  []string{"CH1"},
+	}, {
+		name:        "first terminator wins",
+		chunks:      []string{"one\ntwo\r\nthree\r"},
+		terminators: []string{"\r\n", "\n", "\r"},
+		lines:       []string{"one", "two", "three"},
+	}, {
+		name:        "terminator split across reads",
+		chunks:      []string{"CH1\r", "\nCH2\r", "\n"},
+		terminators: []string{"\r\n", "\r"},
+		lines:       []string{"CH1", "CH2"},
+	}, {
+		name:   "prompts are removed",
+		chunks: []string{"CMX44AB> ", "STATUS\r\nCMX44AB> \r\n01      01\r\n"},
+		prompt: prompt,
+		lines:  []string{"STATUS", "01      01"},
+	}, {
+		name:   "errors are returned",
+		chunks: []string{"CH1\r\nCH"},
+		err:    readErr,
+		lines:  []string{"CH1"},
+	}}
+
+	for _, test := range tests {
+		err := test.err
+		if err == nil {
+			err = io.EOF
+		}
+		lines := NewLineReader(&chunkedReader{chunks: test.chunks, err: err}, test.terminators...)
+		lines.Prompt = test.prompt
+
+		var read []string
+		var lastErr error
+		for {
+			line, err := lines.ReadLine()
+			if err != nil {
+				lastErr = err
+				break
+			}
+			read = append(read, line)
+		}
+
+		if !reflect.DeepEqual(read, test.lines) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.lines, read)
+		}
+		if lastErr != err {
+			t.Errorf("%s: expected the error %v, got %v", test.name, err, lastErr)
+		}
+	}
+}
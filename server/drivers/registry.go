@@ -0,0 +1,161 @@
+package drivers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Config is the configuration block for a single instance of a driver.
+type Config struct {
+	// Type is the name the driver registered itself with (eg, "blustream", "startech_kvm").
+	Type string `json:"type" yaml:"type"`
+
+	// ShortName is the name that layout actions use to refer to this instance.
+	ShortName string `json:"name" yaml:"name"`
+
+	// Transport is how the device is connected: "serial" (the default) or "tcp".
+	Transport string `json:"transport,omitempty" yaml:"transport,omitempty"`
+
+	SerialDevice string `json:"serial_device,omitempty" yaml:"serial_device,omitempty"`
+	SerialBaud   int    `json:"baud,omitempty" yaml:"baud,omitempty"`
+
+	// Address is the host (and port, which defaults to 23) of a device that is connected over tcp.
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+
+	// Timeout is how long to wait for the device to respond to a command.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// InitDelay is how long to wait after opening the connection before talking to the device.
+	InitDelay time.Duration `json:"init_delay,omitempty" yaml:"init_delay,omitempty"`
+
+	// ReconnectDelay is how long to wait before trying to open the connection again after it fails.
+	// The delay doubles after each attempt, up to 30s.
+	ReconnectDelay time.Duration `json:"reconnect_delay,omitempty" yaml:"reconnect_delay,omitempty"`
+
+	// Inputs and Outputs are the number of ports on the device.
+	// They are used to check the layout before the device has been able to tell us about itself.
+	Inputs  int `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Outputs int `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+
+	// Aliases are friendly names for the ports, that can be used anywhere the name of a port can.
+	Aliases Aliases `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+// Aliases are friendly names for the ports on a device (eg, input "03" is "ps5").
+// The maps go from the name of the port to its alias.
+type Aliases struct {
+	Inputs  map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+}
+
+// InputPort returns the input that name is an alias for. If name is not an alias, it is returned as it is.
+func (a Aliases) InputPort(name string) string {
+	return portFor(a.Inputs, name)
+}
+
+// OutputPort returns the output that name is an alias for. If name is not an alias, it is returned as it is.
+func (a Aliases) OutputPort(name string) string {
+	return portFor(a.Outputs, name)
+}
+
+func portFor(aliases map[string]string, name string) string {
+	if _, isPort := aliases[name]; isPort {
+		return name
+	}
+	for port, alias := range aliases {
+		if alias == name {
+			return port
+		}
+	}
+	return name
+}
+
+// IsAlias checks if name is one of the aliases (for either an input or an output).
+func (a Aliases) IsAlias(name string) bool {
+	return portFor(a.Inputs, name) != name || portFor(a.Outputs, name) != name
+}
+
+// Configured is implemented by drivers that can tell us the configuration they were created with.
+type Configured interface {
+	Config() Config
+}
+
+// AliasesOf returns the aliases that have been configured for a driver.
+func AliasesOf(driver DriverInterface) Aliases {
+	if configured, ok := driver.(Configured); ok {
+		return configured.Config().Aliases
+	}
+	return Aliases{}
+}
+
+// WithDefaults fills in any setting that has not been configured from defaults.
+func (c Config) WithDefaults(defaults Config) Config {
+	if c.ShortName == "" {
+		c.ShortName = defaults.ShortName
+	}
+	if c.Transport == "" {
+		c.Transport = defaults.Transport
+	}
+	if c.SerialDevice == "" {
+		c.SerialDevice = defaults.SerialDevice
+	}
+	if c.SerialBaud == 0 {
+		c.SerialBaud = defaults.SerialBaud
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.InitDelay == 0 {
+		c.InitDelay = defaults.InitDelay
+	}
+	if c.ReconnectDelay == 0 {
+		c.ReconnectDelay = defaults.ReconnectDelay
+	}
+	if c.Inputs == 0 {
+		c.Inputs = defaults.Inputs
+	}
+	if c.Outputs == 0 {
+		c.Outputs = defaults.Outputs
+	}
+	return c
+}
+
+// Factory creates a new instance of a driver from its configuration block.
+type Factory func(config Config) (DriverInterface, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a driver available to the configuration under driverType.
+// Drivers should call this from init(), so that importing the package is enough to use it.
+func Register(driverType string, factory Factory) {
+	if _, exists := factories[driverType]; exists {
+		panic(fmt.Sprintf("drivers: a driver has already been registered as [%s]", driverType))
+	}
+	factories[driverType] = factory
+}
+
+// IsRegistered will check if there is a driver registered as driverType.
+func IsRegistered(driverType string) bool {
+	_, exists := factories[driverType]
+	return exists
+}
+
+// Types returns the names of all the drivers that have been registered.
+func Types() []string {
+	var types []string
+	for driverType := range factories {
+		types = append(types, driverType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New creates a new instance of the driver that was registered as config.Type.
+func New(config Config) (DriverInterface, error) {
+	factory, exists := factories[config.Type]
+	if !exists {
+		return nil, fmt.Errorf("there is no driver of type [%s]", config.Type)
+	}
+	return factory(config)
+}
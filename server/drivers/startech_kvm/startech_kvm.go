@@ -1,20 +1,44 @@
 package startech_kvm
 
 import (
-	"bytes"
-	"github.com/tarm/serial"
+	"encoding/json"
+	"errors"
+	"fmt"
 	d "github.com/timgws/kvm-switch/server/drivers"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const EnableDebugMode = false
 
-type StartechConfig struct {
-	SerialDevice string
-	SerialBaud int
+// DefaultConfig holds the settings that are used when they have not been configured.
+var DefaultConfig = d.Config{
+	ShortName: "kvm",
+	SerialBaud: 115200,
+	Timeout: 5 * time.Second,
+	InitDelay: 500 * time.Millisecond,
+	Inputs: 4,
+	Outputs: 1,
+}
+
+// These are from the drivers package, as the driver methods use d for the driver (hiding the package).
+var (
+	openTransport    = d.OpenTransport
+	reconnect        = d.Reconnect
+	notifyConnection = d.NotifyConnection
+	newLineReader    = d.NewLineReader
+)
+
+func init() {
+	d.Register("startech_kvm", func(config d.Config) (d.DriverInterface, error) {
+		if err := config.CheckTransport(); err != nil {
+			return nil, fmt.Errorf("startech_kvm: %w", err)
+		}
+		return NewInstance(config), nil
+	})
 }
 
 type StartechState struct {
@@ -28,7 +52,7 @@ type StartechKvm struct {
 	d.Driver
 	d.OutputSingle
 
-	config    StartechConfig
+	config    d.Config
 	isRunning bool
 
 	StartAttempted bool
@@ -41,25 +65,45 @@ type StartechKvm struct {
 	messages       chan string
 	serialResponse chan string
 
+	// done is closed when the driver is shut down, to stop reading & writing to the device.
+	done chan struct{}
+	port d.Transport
+
+	// finishedSwap receives nil when the KVM reports the channel it swapped to, or an error if the swap failed.
+	finishedSwap chan error
+
+	// lock guards the connection (port, isRunning, HasError & Error) and what the KVM has told us, which are updated
+	// by the goroutines reading from the KVM.
+	lock sync.Mutex
+
 	state      StartechState
 	switching  bool
 	switched   bool
 	firstError bool
 }
 
-func NewInstance() *StartechKvm {
+// NewInstance create a new instance of a Startech KVM.
+// Anything that has not been set in config will be taken from DefaultConfig.
+func NewInstance(config d.Config) *StartechKvm {
+	config = config.WithDefaults(DefaultConfig)
+
+	// The KVM can't tell us about its inputs, so they are made from the config.
+	var inputs []d.Input
+	for i := 1; i <= config.Inputs; i++ {
+		name := strconv.Itoa(i)
+		inputs = append(inputs, d.Input{InputName: name, Alias: config.Aliases.Inputs[name]})
+	}
+
 	return &StartechKvm{
 		isRunning: false,
 		Driver: d.Driver{
 			Name: "Startech SV431DVIUDDM",
-			ShortName: "kvm",
-		},
-		config: StartechConfig{
-			SerialDevice: "/dev/tty.usbserial-141140",
-			SerialBaud: 115200,
+			ShortName: config.ShortName,
+			Inputs: inputs,
 		},
-		NumOfInputs: 4,
-		NumOfOutputs: 1,
+		config: config,
+		NumOfInputs: config.Inputs,
+		NumOfOutputs: config.Outputs,
 		firstError: true,
 		state: StartechState{},
 	}
@@ -73,6 +117,8 @@ func (d *StartechKvm) SupportsInitState() bool {
 
 // IsRunning will show if the device is being read from or not.
 func (d *StartechKvm) IsRunning() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	return d.isRunning
 }
 
@@ -81,44 +127,149 @@ func (d *StartechKvm) GetShortName() string {
 }
 
 // Start will initialize the connection...
+// If the KVM can't be opened, the driver keeps trying to connect to it in the background.
 func (d *StartechKvm) Start() bool {
 	d.StartAttempted = true
-	s_dev := d.config.SerialDevice
-	s_baud := d.config.SerialBaud
+	d.done = make(chan struct{})
+	d.messages = make(chan string)
+	d.serialResponse = make(chan string)
+	d.finishedSwap = make(chan error, 1)
 
-	c := &serial.Config{Name: s_dev, Baud: s_baud}
-	s, err := serial.OpenPort(c)
+	go d.processResponses()
+
+	go d.writePort()
+
+	s, err := openTransport(d.config)
 	if err != nil {
-		d.Error = err
+		d.setError(err)
+		go d.reconnect()
 		return false
 	}
 
-	go d.readPort(s)
-	go d.init(s)
+	d.connected(s)
+	return true
+}
 
-	go d.processResponses()
+// connected starts reading from a connection that has just been opened, and probes the KVM.
+// The driver is running again once the KVM has replied to the probe.
+// It returns false (closing the connection) if the driver was shut down while the KVM was being opened.
+func (d *StartechKvm) connected(port d.Transport) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.stopped() {
+		port.Close()
+		return false
+	}
+
+	d.port = port
+	d.HasError = false
+	d.Error = nil
+	d.firstError = true
+	// The KVM may have been power cycled (or swapped with its buttons) while it was gone, so the port it is on is not
+	// known until it tells us again.
+	d.state.CurrentDevice = 0
+
+	go d.readPort(port)
+	go d.init(port)
+	return true
+}
+
+// disconnected closes a connection that has failed (eg, the USB serial adapter was unplugged), and starts
+// trying to reconnect.
+func (d *StartechKvm) disconnected(port d.Transport, err error) {
+	d.lock.Lock()
+	if d.stopped() {
+		// Shutdown has closed the port, which is why reading from it failed.
+		d.lock.Unlock()
+		return
+	}
+	d.isRunning = false
+	d.HasError = true
+	d.Error = err
+	d.port = nil
+	d.lock.Unlock()
 
-	go d.writePort(s)
+	log.Printf("[startech_kvm]: Lost the connection to %s: %s", d.config.Connection(), err)
+	port.Close()
 
+	notifyConnection(d.ShortName, err)
+	go d.reconnect()
+}
+
+// reconnect opens the KVM again (waiting longer between each attempt), then probes it.
+func (d *StartechKvm) reconnect() {
+	port := reconnect(d.config, d.done)
+	if port == nil {
+		return
+	}
+
+	if d.connected(port) {
+		notifyConnection(d.ShortName, nil)
+	}
+}
+
+// Shutdown stops talking to the KVM, and closes the serial port.
+func (d *StartechKvm) Shutdown() bool {
+	d.lock.Lock()
+	if d.done == nil || d.stopped() {
+		d.lock.Unlock()
+		return false
+	}
+
+	close(d.done)
+	d.isRunning = false
+	port := d.port
+	d.port = nil
+	d.lock.Unlock()
+
+	if port == nil {
+		return true
+	}
+	if err := port.Close(); err != nil {
+		d.lock.Lock()
+		d.Error = err
+		d.lock.Unlock()
+		return false
+	}
 	return true
 }
 
+// stopped checks if the driver has been shut down.
+func (d *StartechKvm) stopped() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// setError records that talking to the KVM has failed.
+func (d *StartechKvm) setError(err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.HasError = true
+	d.Error = err
+}
+
 // init the device.
-func (d *StartechKvm) init(port *serial.Port) {
+func (d *StartechKvm) init(port d.Transport) {
 	// (Either) the startech is a bit dodge, or my USB->RS232 is a bit dodge.
 	// let's send a fake command and wait for the error response.
 	d.StartAttempted = true
-	time.Sleep(time.Millisecond * 500)
+	time.Sleep(d.config.InitDelay)
+	// Throw away anything left over from before a reconnect. Flushing after the write could drop the probe before it is sent.
+	port.Flush()
 	n, err := port.Write([]byte("HI!\r\n"))
 	if err != nil {
-		d.Error = err
-		d.HasError = true
+		d.setError(err)
 		log.Printf("Could not send %d bytes for driver.", n)
 	}
-	port.Flush()
 }
 
 func (d *StartechKvm) DriverName() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	return d.Name
 }
 
@@ -128,152 +279,216 @@ func (d *StartechKvm) GetStatus() {
 
 
 // writePort manages a channel that allows us to send & receive data to this serial connection.
-func (d *StartechKvm) writePort(port *serial.Port) {
-	d.messages = make(chan string)
+func (d *StartechKvm) writePort() {
 	log.Printf("WRITE PORT STARTED")
 
 	go func() {
 		for {
 			select {
+			case <-d.done:
+				return
 			case msg := <-d.messages:
 				log.Printf("==> WRITE PORT MSG: %s", msg)
+				d.lock.Lock()
+				port := d.port
+				d.lock.Unlock()
+				if port == nil {
+					d.finishSwap(fmt.Errorf("%s is not connected", d.ShortName))
+					continue
+				}
 				n, err := port.Write([]byte(msg + "\r\n"))
 				if err != nil {
 					log.Printf("Error writing %d bytes: %s", n, err)
-					d.HasError = true
-					d.Error = err
+					d.setError(err)
+					d.finishSwap(err)
 				}
 			}
 		}
 	}()
 }
 
-// readPort continuously reads data from the serial port, checks if there is some new data received
-// and sends it down to the serialResponse channel when we are g2g with a response from a command.
-//
-// TODO: This needs a big refactor. It's a little dodgy, but it does the trick.
-func (d *StartechKvm) readPort(port *serial.Port) {
-	var command string
+// readPort reads lines from the KVM, and sends them down to the serialResponse channel.
+// If the connection fails, the driver starts trying to reconnect.
+func (d *StartechKvm) readPort(port d.Transport) {
+	lines := newLineReader(port)
 	for {
-		buf := make([]byte, 60)
-		n, err := port.Read(buf)
+		line, err := lines.ReadLine()
 		if err != nil {
-			log.Fatal(n, err)
-		}
-
-
-		b := bytes.Trim(buf, "\x00")
-		tmpString := string(b)
-		command = command + tmpString
-
-		commands := strings.Split(command, "\r\n")
-
-		if EnableDebugMode {
-			log.Printf("BUFFER CONTENTS: %s tmpString %s", buf, tmpString)
-			log.Printf("commands: %s", commands)
+			d.disconnected(port, err)
+			return
 		}
 
-		numCommands := len(commands)
-		if numCommands > 1 {
-			for i := range commands {
-				// if we are at the last command, check that we have an empty command...
-				if i == numCommands-1 {
-					if commands[i] == "" {
-						buf = []byte("")
-						log.Printf("BUFFER: %s %q", buf, buf)
-						continue
-					}
-				} else if i != numCommands {
-					currentCommand := commands[0]
-					if len(commands) > 1 {
-						numCommands--
-						commands = commands[1:]
-
-						//buf = []byte(string(commands.joi))
-						command = strings.Join(commands, "\r\n")
-						buf = []byte(command)
-					}
-
-					d.serialResponse <- currentCommand
-
-					log.Printf("[startech_kvm] Command #%d/%d: %s", i+1, len(commands), currentCommand)
-				}
-			}
-		} else {
-			if EnableDebugMode {
-				log.Printf("Incomplete command from serial... expected newline")
-			}
+		select {
+		case d.serialResponse <- line:
+		case <-d.done:
+			return
 		}
-
-		if EnableDebugMode {
-			log.Printf("*-*-*-**-*-**-*-*-**-*-**-*-*-**-*-**-*-*-**-*-**-*-*-**-*-**-*-*-**-*-**-*-*-**-*-*")
-			log.Printf("BUFFER CONTENTS: %s tmpString %s", buf, tmpString)
-			log.Printf("commands: %s", commands)
-			log.Printf("%q", buf)
-			log.Printf("---------------------------")
-		}
-
-		//log.Printf("%s %q", buf, buf)
+		log.Printf("[startech_kvm] Command: %s", line)
 	}
 }
 
 // processResponses reads serial commands that have been fully read from the serial connection.
 func (d *StartechKvm) processResponses() {
-	d.serialResponse = make(chan string)
-
 	go func() {
 		for {
 			select {
+			case <-d.done:
+				return
 			case msg := <-d.serialResponse:
 				if EnableDebugMode {
 					log.Printf("<== [STARTECH] READ SERIAL COMMAND: %s %q", msg, msg)
 				}
+				d.lock.Lock()
+				d.processResponse(msg)
+				d.lock.Unlock()
+			}
+		}
+	}()
+}
 
-				if msg == "ERROR" {
-					if !d.firstError {
-						d.HasError = true
-					} else {
-						log.Printf("Ignore the first error, we are just initializing our state - looks like this device is correct")
-						d.firstError = false
-						d.isRunning = true
-					}
-					continue
-				}
+// processResponse handles a single line from the KVM. d.lock must be held.
+func (d *StartechKvm) processResponse(msg string) {
+	if msg == "ERROR" {
+		if !d.firstError {
+			d.HasError = true
+			d.finishSwap(errors.New("the KVM responded with ERROR"))
+		} else {
+			log.Printf("Ignore the first error, we are just initializing our state - looks like this device is correct")
+			d.firstError = false
+			d.isRunning = true
+		}
+		return
+	}
 
-				if strings.Contains(msg, "F/W Version") {
-					// unlike Blustream, we only get to know the device when it boots.
-					// SV431DVIUDDM F/W Version :H2K B4.1
-					version := strings.Split(msg, " ")
-					if len(version) == 5 {
-						fwVersion := strings.Replace(strings.Join(version[3:], " "), ":", "", 1)
-						d.Driver.Name = "Startech.com " + version[0] + fwVersion
-						log.Println("[startech_kvm]: New driver name is: " + d.Driver.Name)
-					}
-				}
+	if strings.Contains(msg, "F/W Version") {
+		// unlike Blustream, we only get to know the device when it boots.
+		// SV431DVIUDDM F/W Version :H2K B4.1
+		version := strings.Split(msg, " ")
+		if len(version) == 5 {
+			fwVersion := strings.Replace(strings.Join(version[3:], " "), ":", "", 1)
+			d.Driver.Name = "Startech.com " + version[0] + fwVersion
+			log.Println("[startech_kvm]: New driver name is: " + d.Driver.Name)
+		}
+	}
 
-				if len(msg) == 3 {
-					if msg[:2] == "CH" {
-						log.Println(msg, msg[2:])
-						chn, err := strconv.Atoi(msg[2:])
-						if err != nil {
-							d.HasError = true
-							d.Error = err
-						}
-
-						d.state.CurrentDevice = chn
-					}
-				}
+	if len(msg) == 3 {
+		if msg[:2] == "CH" {
+			log.Println(msg, msg[2:])
+			chn, err := strconv.Atoi(msg[2:])
+			if err != nil {
+				d.HasError = true
+				d.Error = err
 			}
+
+			d.state.CurrentDevice = chn
+			d.finishSwap(err)
 		}
+	}
+}
+
+// SetOutput swaps the KVM to an input, and waits for the KVM to tell us which channel it is now on.
+func (d *StartechKvm) SetOutput(inputName string) error {
+	if err := d.startSwitching(); err != nil {
+		return err
+	}
+	defer func() {
+		d.lock.Lock()
+		d.switching = false
+		d.lock.Unlock()
 	}()
+
+	select {
+	case d.messages <- "K1P" + inputName:
+	case <-d.done:
+		return fmt.Errorf("%s has been shut down", d.ShortName)
+	}
+
+	select {
+	case err := <-d.finishedSwap:
+		if err != nil {
+			return err
+		}
+		if current, _ := d.CurrentInput(); current != inputName {
+			return fmt.Errorf("%s swapped to input %s instead of %s", d.ShortName, current, inputName)
+		}
+		return nil
+	case <-time.After(d.config.Timeout):
+		log.Printf("[startech_kvm]: Timed out waiting to swap to input %s", inputName)
+		return fmt.Errorf("timed out waiting for %s to swap to input %s", d.ShortName, inputName)
+	}
+}
+
+// startSwitching checks that the KVM can be swapped, and marks it as switching.
+func (d *StartechKvm) startSwitching() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.port == nil {
+		return fmt.Errorf("%s is not connected", d.ShortName)
+	}
+	if d.switching {
+		return fmt.Errorf("%s is already switching", d.ShortName)
+	}
+
+	// Throw away a reply that arrived after an earlier swap timed out.
+	select {
+	case <-d.finishedSwap:
+	default:
+	}
+	d.switching = true
+	return nil
+}
+
+// finishSwap lets SetOutput know that a swap has finished (if anything is waiting for one).
+func (d *StartechKvm) finishSwap(err error) {
+	select {
+	case d.finishedSwap <- err:
+	default:
+	}
+}
+
+// CurrentInput returns the port the KVM has selected, once the KVM has told us (it reports CHn when it swaps).
+func (d *StartechKvm) CurrentInput() (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.state.CurrentDevice == 0 {
+		return "", false
+	}
+	return strconv.Itoa(d.state.CurrentDevice), true
+}
+
+// InputNames returns the ports on the KVM (1, 2, ...)
+func (d *StartechKvm) InputNames() []string {
+	var names []string
+	for i := 1; i <= d.NumOfInputs; i++ {
+		names = append(names, strconv.Itoa(i))
+	}
+	return names
+}
+
+// OutputNames returns nothing, there is only one output on the KVM.
+func (d *StartechKvm) OutputNames() []string {
+	return nil
+}
+
+// MarshalJSON locks the driver, so that /driverStatus does not read it while it is being updated.
+func (d *StartechKvm) MarshalJSON() ([]byte, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// kvm does not have this method, so json does not call it again.
+	type kvm StartechKvm
+	return json.Marshal((*kvm)(d))
 }
 
-func (d *StartechKvm) SetOutput(inputName string) {
-    //d.messages <- "CH" + inputName
-	d.messages <- "K1P" + inputName
+// Config returns the configuration that the KVM was created with.
+func (d *StartechKvm) Config() d.Config {
+	return d.config
 }
 
 func (d *StartechKvm) LastError() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	return d.Error
 }
 
@@ -0,0 +1,56 @@
+package startech_kvm
+
+import (
+	"testing"
+	"time"
+
+	d "github.com/timgws/kvm-switch/server/drivers"
+	"github.com/timgws/kvm-switch/server/emulator"
+)
+
+// waitFor checks condition until it is true, failing the test if it takes too long.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for wait := time.Now(); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(wait) > 2*time.Second {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestDriverOverPty(t *testing.T) {
+	kvm := emulator.NewStartech(4)
+	pty, err := emulator.OpenPty(kvm)
+	if err != nil {
+		t.Skipf("Could not create a pty: %s", err)
+	}
+
+	driver := NewInstance(d.Config{SerialDevice: pty.Name, Timeout: time.Second, InitDelay: time.Millisecond})
+	if !driver.Start() {
+		t.Fatalf("Could not start the driver: %s", driver.LastError())
+	}
+	// The pty is closed first, as closing the serial port waits for the driver's read to finish.
+	t.Cleanup(func() { driver.Shutdown() })
+	t.Cleanup(func() { pty.Close() })
+
+	// The KVM replies ERROR to the probe, then sends its banner.
+	waitFor(t, "the driver to start", driver.IsRunning)
+	waitFor(t, "the banner", func() bool { return driver.DriverName() == "Startech.com SV431DVIUDDMH2K B4.1" })
+
+	if err := driver.SetOutput("3"); err != nil {
+		t.Fatalf("Could not swap to input 3: %s", err)
+	}
+	if kvm.Current() != 3 {
+		t.Errorf("Expected the KVM to be on port 3, got %d", kvm.Current())
+	}
+
+	kvm.Press(2)
+	waitFor(t, "the button press", func() bool {
+		input, _ := driver.CurrentInput()
+		return input == "2"
+	})
+
+	if err := driver.SetOutput("7"); err == nil {
+		t.Error("Expected swapping to a port that does not exist to fail")
+	}
+}
@@ -0,0 +1,107 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+const (
+	// TransportSerial talks to a device over an RS232 port (the default).
+	TransportSerial = "serial"
+	// TransportTCP talks to a device over a TCP socket (eg, the telnet port of a matrix).
+	TransportTCP = "tcp"
+)
+
+// Transports are the ways a driver can be connected to its device.
+var Transports = []string{TransportSerial, TransportTCP}
+
+// defaultTCPPort is used when an address does not have a port, as most devices use telnet for their ASCII protocol.
+const defaultTCPPort = "23"
+
+// defaultDialTimeout is how long to wait for a TCP connection when the driver does not have a timeout.
+const defaultDialTimeout = 5 * time.Second
+
+// Transport is the connection to a device. Drivers read & write the device's protocol over it, without needing to
+// know if the device is plugged in to a serial port or is on the network.
+type Transport interface {
+	io.ReadWriteCloser
+
+	// Flush discards anything that has been received but not read (for serial ports), or does nothing.
+	Flush() error
+}
+
+// TransportName returns the transport that has been configured (serial, unless something else has been set).
+func (c Config) TransportName() string {
+	if c.Transport == "" {
+		return TransportSerial
+	}
+	return c.Transport
+}
+
+// CheckTransport checks that the settings the transport needs have been configured.
+func (c Config) CheckTransport() error {
+	switch c.TransportName() {
+	case TransportSerial:
+		if c.SerialDevice == "" {
+			return errors.New("serial_device has not been configured")
+		}
+	case TransportTCP:
+		if c.Address == "" {
+			return errors.New("address has not been configured")
+		}
+	default:
+		return fmt.Errorf("unknown transport [%s]", c.Transport)
+	}
+	return nil
+}
+
+// Connection describes where the device is connected, for logs (eg, /dev/ttyUSB0 or tcp://10.0.0.5:23).
+func (c Config) Connection() string {
+	if c.TransportName() == TransportTCP {
+		return "tcp://" + tcpAddress(c.Address)
+	}
+	return c.SerialDevice
+}
+
+// OpenTransport opens the connection to a device, using the transport that has been configured.
+func OpenTransport(config Config) (Transport, error) {
+	if err := config.CheckTransport(); err != nil {
+		return nil, err
+	}
+
+	if config.TransportName() == TransportTCP {
+		timeout := config.Timeout
+		if timeout == 0 {
+			timeout = defaultDialTimeout
+		}
+		conn, err := net.DialTimeout("tcp", tcpAddress(config.Address), timeout)
+		if err != nil {
+			return nil, err
+		}
+		return &tcpTransport{conn}, nil
+	}
+
+	return serial.OpenPort(&serial.Config{Name: config.SerialDevice, Baud: config.SerialBaud})
+}
+
+// tcpAddress adds the default port to an address that does not have one.
+func tcpAddress(address string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, defaultTCPPort)
+	}
+	return address
+}
+
+// tcpTransport is a device on the network. There is nothing to flush, anything written is sent straight away.
+type tcpTransport struct {
+	net.Conn
+}
+
+func (t *tcpTransport) Flush() error {
+	return nil
+}
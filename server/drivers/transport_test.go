@@ -0,0 +1,52 @@
+package drivers
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+func TestTCPTransport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The fake device echoes back each line it receives.
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("echo " + line))
+	}()
+
+	transport, err := OpenTransport(Config{Transport: TransportTCP, Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("Could not connect: %s", err)
+	}
+	defer transport.Close()
+
+	if _, err := transport.Write([]byte("STATUS\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	response, err := bufio.NewReader(transport).ReadString('\n')
+	if err != nil || response != "echo STATUS\r\n" {
+		t.Errorf("Expected the line to be echoed, got %q (%v)", response, err)
+	}
+}
+
+func TestTransportSettings(t *testing.T) {
+	if err := (Config{}).CheckTransport(); err == nil || err.Error() != "serial_device has not been configured" {
+		t.Errorf("Expected serial to be the default transport, got %v", err)
+	}
+	if connection := (Config{Transport: TransportTCP, Address: "10.0.0.5"}).Connection(); connection != "tcp://10.0.0.5:23" {
+		t.Errorf("Expected port 23 to be used when there is no port, got %s", connection)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ActionStatus is what happened to an action when it was effected.
+type ActionStatus string
+
+const (
+	// ActionPerformed means that the driver was told to perform the action.
+	ActionPerformed ActionStatus = "performed"
+	// ActionSkipped means the device was already in the state the action would put it in, so nothing was sent.
+	ActionSkipped ActionStatus = "skipped"
+	// ActionFailed means the action could not be performed.
+	ActionFailed ActionStatus = "failed"
+	// ActionCancelled means the action was not attempted, because an action before it failed.
+	ActionCancelled ActionStatus = "cancelled"
+)
+
+// ActionResult is what happened to a single action.
+type ActionResult struct {
+	Action Action       `json:"action"`
+	Status ActionStatus `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+// EffectResult describes what happened to each of the actions given to Effect.
+type EffectResult struct {
+	Success bool           `json:"success"`
+	Actions []ActionResult `json:"actions"`
+	Error   string         `json:"error,omitempty"`
+
+	// RolledBack are the actions that were performed to put outputs back how they were, after an action failed.
+	RolledBack []ActionResult `json:"rolled_back,omitempty"`
+}
+
+// Skipped returns the actions that did not need to be performed.
+func (r *EffectResult) Skipped() []Action {
+	var skipped []Action
+	for _, result := range r.Actions {
+		if result.Status == ActionSkipped {
+			skipped = append(skipped, result.Action)
+		}
+	}
+	return skipped
+}
+
+// Failed returns the actions that could not be performed.
+func (r *EffectResult) Failed() []ActionResult {
+	var failed []ActionResult
+	for _, result := range r.Actions {
+		if result.Status == ActionFailed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Effect tells the drivers to perform the actions for a given device in the matrix.
+// Actions that would not change anything (eg, the output is already showing the input) are skipped.
+//
+// The actions for each driver are performed in order, but different drivers are told what to do at the same time
+// (so a KVM does not have to wait for a matrix to finish swapping). If the order across drivers matters, a barrier
+// action waits for everything before it to finish.
+//
+// Scenes are expanded (and conditions checked) as Effect gets to them, so a condition after a barrier sees what the
+// drivers know once everything before the barrier has finished.
+//
+// If an action fails, nothing after it is attempted. When the layout has rollback turned on, the outputs that
+// were already changed are put back to what they were showing before Effect started (if the driver told us).
+func (l *Layout) Effect(actions *[]Action) *EffectResult {
+	return l.effectOnly(actions, nil)
+}
+
+// effectOnly performs actions like Effect, but leaves out (and does not report) the actions that only returns false
+// for once their scenes & conditions have been expanded. Everything is performed when only is nil.
+func (l *Layout) effectOnly(actions *[]Action, only func(Action) bool) *EffectResult {
+	result := &EffectResult{Success: true}
+	if actions == nil || len(*actions) < 1 {
+		return result
+	}
+
+	snapshot := RoutingState{}
+	queue := queueActions(*actions, 0)
+	failed := false
+	for len(queue) > 0 && !failed {
+		phase, skipped, rest, err := l.nextPhase(queue)
+		queue = rest
+		if only != nil {
+			phase, skipped = onlyActions(phase, only), onlyResults(skipped, only)
+		}
+		result.Actions = append(result.Actions, skipped...)
+		if err != nil {
+			log.Printf("Not performing actions: %s", err)
+			result.Error = err.Error()
+			failed = true
+			break
+		}
+
+		snapshot.record(phase)
+		phaseResults := performConcurrently(phase)
+		result.Actions = append(result.Actions, phaseResults...)
+		for _, phaseResult := range phaseResults {
+			if phaseResult.Status == ActionFailed {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		result.Success = false
+		cancelled := l.cancelled(queue)
+		if only != nil {
+			cancelled = onlyResults(cancelled, only)
+		}
+		result.Actions = append(result.Actions, cancelled...)
+		if failures := result.Failed(); len(failures) > 0 {
+			result.Error = fmt.Sprintf("%d action(s) failed, the first was: %s", len(failures), failures[0].Reason)
+		}
+		if l.Rollback {
+			result.RolledBack = rollback(result.Actions, snapshot)
+		}
+	}
+
+	if skipped := result.Skipped(); EnableDebugMode && len(skipped) > 0 {
+		log.Printf("Skipped %d action(s) that were already in place", len(skipped))
+	}
+	return result
+}
+
+// queuedAction is an action that is waiting to be performed by Effect.
+type queuedAction struct {
+	action Action
+	// depth is how many scenes (or conditions) deep the action came from.
+	depth int
+}
+
+// queueActions gets actions ready to be performed by Effect.
+func queueActions(actions []Action, depth int) []queuedAction {
+	queue := make([]queuedAction, len(actions))
+	for i, action := range actions {
+		queue[i] = queuedAction{action: action, depth: depth}
+	}
+	return queue
+}
+
+// nextPhase takes the actions that can be performed at the same time from the front of the queue, up to the next
+// barrier. Steps (eg, sleep) are also barriers, and are returned in a phase on their own.
+//
+// Scenes and conditions are expanded into the queue as they are reached. The actions that were not performed because
+// their condition was not met are returned as skipped, and the rest of the queue is returned for the next phase.
+func (l *Layout) nextPhase(queue []queuedAction) (phase []Action, skipped []ActionResult, rest []queuedAction, err error) {
+	for len(queue) > 0 {
+		item := queue[0]
+		action := item.action
+		if item.depth > maxSceneDepth {
+			return nil, skipped, queue, fmt.Errorf("scenes are nested more than %d deep", maxSceneDepth)
+		}
+
+		if action.When != nil {
+			branch := action.Else
+			if action.When.met() {
+				action.When = nil
+				action.Else = nil
+				branch = []Action{action}
+			} else {
+				skipped = append(skipped, ActionResult{Action: item.action, Status: ActionSkipped, Reason: fmt.Sprintf("the condition was not met (%s)", action.When)})
+			}
+			queue = append(queueActions(branch, item.depth+1), queue[1:]...)
+			continue
+		}
+
+		if action.Scene != "" {
+			scene := l.findScene(action.Scene)
+			if scene == nil {
+				return nil, skipped, queue, fmt.Errorf("scene [%s] was not found", action.Scene)
+			}
+			branch := scene.Actions
+			if scene.When != nil && !scene.When.met() {
+				branch = scene.Else
+				if EnableDebugMode {
+					log.Printf("Using the else actions for scene [%s], the condition was not met (%s)", scene.Name, scene.When)
+				}
+			}
+			queue = append(queueActions(branch, item.depth+1), queue[1:]...)
+			continue
+		}
+
+		if action.Barrier || action.isStep() {
+			if len(phase) > 0 {
+				return phase, skipped, queue, nil
+			}
+			queue = queue[1:]
+			if action.isStep() {
+				return []Action{action}, skipped, queue, nil
+			}
+			continue
+		}
+
+		phase = append(phase, action)
+		queue = queue[1:]
+	}
+	return phase, skipped, queue, nil
+}
+
+// onlyActions returns the actions that only returns true for.
+func onlyActions(actions []Action, only func(Action) bool) []Action {
+	var kept []Action
+	for _, action := range actions {
+		if only(action) {
+			kept = append(kept, action)
+		}
+	}
+	return kept
+}
+
+// onlyResults returns the results for the actions that only returns true for.
+func onlyResults(results []ActionResult, only func(Action) bool) []ActionResult {
+	var kept []ActionResult
+	for _, result := range results {
+		if only(result.Action) {
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
+
+// cancelled returns a result for each action left in the queue, after an action has failed.
+// Conditions are not checked, and actions guarded by a condition are listed as they are.
+func (l *Layout) cancelled(queue []queuedAction) []ActionResult {
+	var remaining []Action
+	for _, item := range queue {
+		remaining = append(remaining, item.action)
+	}
+	if expanded, err := l.expandScenes(remaining); err == nil {
+		remaining = expanded
+	}
+
+	var results []ActionResult
+	for _, action := range remaining {
+		if action.Barrier {
+			continue
+		}
+		results = append(results, ActionResult{Action: action, Status: ActionCancelled, Reason: "an earlier action failed"})
+	}
+	return results
+}
+
+// rollback puts the outputs changed by the performed actions back to the input they were showing in the snapshot.
+// Outputs are put back in the reverse order that they were changed.
+func rollback(results []ActionResult, snapshot RoutingState) []ActionResult {
+	var restored []ActionResult
+	seen := map[string]bool{}
+	for i := len(results) - 1; i >= 0; i-- {
+		// An action that failed part way through might have already switched some of its outputs.
+		performed := results[i]
+		if performed.Status != ActionPerformed && performed.Status != ActionFailed {
+			continue
+		}
+
+		action := performed.Action
+		driver := findDriver(action.DriverName)
+		if driver == nil {
+			continue
+		}
+		routes, err := action.routes(driver)
+		if err != nil || (performed.Status == ActionFailed && len(routes) < 2) {
+			continue
+		}
+
+		for _, route := range routes {
+			if seen[action.DriverName+"/"+route.Output] {
+				continue
+			}
+			seen[action.DriverName+"/"+route.Output] = true
+
+			input, known := snapshot.get(action.DriverName, route.Output)
+			if route.Layer != "" || !known {
+				restored = append(restored, ActionResult{Action: action, Status: ActionSkipped, Reason: fmt.Sprintf("the previous input of %q is not known, it can not be restored", route.Output)})
+				continue
+			}
+
+			undo := Action{DriverName: action.DriverName, PerformAction: input}
+			if route.Output != "" {
+				undo.PerformAction = route.Output + "-" + input
+			}
+			log.Printf("[rollback]: Restoring [%s] %s", undo.DriverName, undo.PerformAction)
+			restored = append(restored, performAction(undo))
+		}
+	}
+	return restored
+}
+
+// performConcurrently performs the actions for each driver in order, with each driver running at the same time.
+// The results are returned in the same order as the actions.
+func performConcurrently(actions []Action) []ActionResult {
+	results := make([]ActionResult, len(actions))
+
+	// Group the actions (by their position in the list) for each driver, keeping their order.
+	var driverOrder []string
+	byDriver := map[string][]int{}
+	for i, action := range actions {
+		if _, seen := byDriver[action.DriverName]; !seen {
+			driverOrder = append(driverOrder, action.DriverName)
+		}
+		byDriver[action.DriverName] = append(byDriver[action.DriverName], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, driverName := range driverOrder {
+		wg.Add(1)
+		go func(positions []int) {
+			defer wg.Done()
+			failed := false
+			for _, i := range positions {
+				if failed {
+					results[i] = ActionResult{Action: actions[i], Status: ActionCancelled, Reason: "an earlier action for this driver failed"}
+					continue
+				}
+				results[i] = performAction(actions[i])
+				failed = results[i].Status == ActionFailed
+			}
+		}(byDriver[driverName])
+	}
+	wg.Wait()
+
+	return results
+}
+
+// performAction tells a driver to perform a single action, unless the driver says it is already done.
+func performAction(item Action) ActionResult {
+	if item.isStep() {
+		return performStep(item)
+	}
+
+	driver := findDriver(item.DriverName)
+	if driver == nil {
+		return failedAction(item, "driver [%s] was not found", item.DriverName)
+	}
+
+	routes, err := item.routes(driver)
+	if err != nil {
+		return failedAction(item, "%s", err)
+	}
+
+	var alreadyDone []string
+	for _, route := range routes {
+		// Drivers only tell us about what is being shown, so a layer on its own is always sent.
+		if current, known := currentRoute(driver, route.Output); known && current == route.Input && route.Layer == "" {
+			alreadyDone = append(alreadyDone, route.Output)
+			continue
+		}
+		if err := setRoute(driver, route); err != nil {
+			return failedAction(item, "[%s] could not %s: %s", item.DriverName, route, err)
+		}
+	}
+
+	if len(alreadyDone) == len(routes) {
+		return ActionResult{Action: item, Status: ActionSkipped, Reason: alreadyDoneReason(routes)}
+	}
+	return ActionResult{Action: item, Status: ActionPerformed}
+}
+
+// alreadyDoneReason describes why routes did not need to be switched.
+func alreadyDoneReason(routes []Route) string {
+	if len(routes) == 1 && routes[0].Output == "" {
+		return fmt.Sprintf("input %s is already selected", routes[0].Input)
+	}
+	if len(routes) == 1 {
+		return fmt.Sprintf("output %s is already showing input %s", routes[0].Output, routes[0].Input)
+	}
+	return fmt.Sprintf("the outputs are already showing input %s", routes[0].Input)
+}
+
+// failedAction logs why an action could not be performed, and returns the result.
+func failedAction(item Action, reason string, v ...interface{}) ActionResult {
+	result := ActionResult{Action: item, Status: ActionFailed, Reason: fmt.Sprintf(reason, v...)}
+	log.Printf("Action failed: %s", result.Reason)
+	return result
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// fakeMatrix is a matrix that remembers its routes.
+type fakeMatrix struct {
+	fakeDriver
+	routes map[string]string
+	sent   []string
+	// failOn is a route (<output>-<input>) that the matrix will fail to swap.
+	failOn string
+}
+
+func (f *fakeMatrix) SetOutput(outputName string, inputName string) error {
+	f.sent = append(f.sent, outputName+"-"+inputName)
+	if outputName+"-"+inputName == f.failOn {
+		return errors.New("write error")
+	}
+	f.routes[outputName] = inputName
+	return nil
+}
+
+func (f *fakeMatrix) CurrentInput(outputName string) (string, bool) {
+	input, known := f.routes[outputName]
+	return input, known
+}
+
+// fakeKvm is a KVM that remembers which input is selected.
+type fakeKvm struct {
+	fakeDriver
+	current string
+	sent    []string
+}
+
+func (f *fakeKvm) SetOutput(inputName string) error {
+	f.sent = append(f.sent, inputName)
+	f.current = inputName
+	return nil
+}
+
+func (f *fakeKvm) CurrentInput() (string, bool) {
+	return f.current, f.current != ""
+}
+
+// useFakeDrivers replaces the registered drivers with a fake matrix & KVM.
+func useFakeDrivers() (*fakeMatrix, *fakeKvm) {
+	matrix := &fakeMatrix{fakeDriver: fakeDriver{config: drivers.Config{ShortName: "matrix"}}, routes: map[string]string{}}
+	kvm := &fakeKvm{fakeDriver: fakeDriver{config: drivers.Config{ShortName: "kvm"}}}
+	Drivers = allDrivers{Drivers: []drivers.DriverInterface{matrix, kvm}}
+	return matrix, kvm
+}
+
+func TestEffectSkipsRoutesAlreadyInPlace(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	matrix.routes["01"] = "01"
+	kvm.current = "2"
+
+	layout := BuildLayout()
+	result := layout.Effect(&[]Action{{Scene: "home"}})
+
+	expected := []ActionStatus{ActionSkipped, ActionPerformed, ActionSkipped}
+	if len(result.Actions) != len(expected) {
+		t.Fatalf("Expected %d results, got %v", len(expected), result.Actions)
+	}
+	for i, status := range expected {
+		if result.Actions[i].Status != status {
+			t.Errorf("Expected action %d to be %s, got %s", i, status, result.Actions[i].Status)
+		}
+	}
+
+	if len(matrix.sent) != 1 || matrix.sent[0] != "02-02" || len(kvm.sent) != 0 {
+		t.Errorf("Only 02-02 should have been sent, got matrix: %v kvm: %v", matrix.sent, kvm.sent)
+	}
+	if len(result.Skipped()) != 2 {
+		t.Errorf("Expected 2 skipped actions, got %v", result.Skipped())
+	}
+}
+
+// blockingMatrix & blockingKvm tell the test when they have started swapping, then wait for it to let them finish.
+type blockingMatrix struct {
+	*fakeMatrix
+	swapping chan<- string
+	release  <-chan struct{}
+}
+
+func (b *blockingMatrix) SetOutput(outputName string, inputName string) error {
+	b.swapping <- "matrix"
+	<-b.release
+	return b.fakeMatrix.SetOutput(outputName, inputName)
+}
+
+type blockingKvm struct {
+	*fakeKvm
+	swapping chan<- string
+	release  <-chan struct{}
+}
+
+func (b *blockingKvm) SetOutput(inputName string) error {
+	b.swapping <- "kvm"
+	<-b.release
+	return b.fakeKvm.SetOutput(inputName)
+}
+
+func TestEffectRunsDriversConcurrently(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	swapping := make(chan string, 4)
+	release := make(chan struct{})
+	Drivers.Drivers = []drivers.DriverInterface{
+		&blockingMatrix{fakeMatrix: matrix, swapping: swapping, release: release},
+		&blockingKvm{fakeKvm: kvm, swapping: swapping, release: release},
+	}
+
+	actions := []Action{
+		{DriverName: "matrix", PerformAction: "01-01"},
+		{DriverName: "matrix", PerformAction: "02-02"},
+		{DriverName: "kvm", PerformAction: "2"},
+		{Barrier: true},
+		{DriverName: "kvm", PerformAction: "3"},
+	}
+
+	layout := BuildLayout()
+	first, _, rest, _ := layout.nextPhase(queueActions(actions, 0))
+	second, _, rest, _ := layout.nextPhase(rest)
+	if len(first) != 3 || len(second) != 1 || len(rest) != 0 {
+		t.Fatalf("Expected the actions to be split at the barrier, got %v then %v", first, second)
+	}
+
+	results := make(chan *EffectResult)
+	go func() { results <- layout.Effect(&actions) }()
+
+	// Neither driver can finish until the other has started, so this only works if they swap at the same time.
+	inside := map[string]bool{}
+	for len(inside) < 2 {
+		select {
+		case driver := <-swapping:
+			inside[driver] = true
+		case <-time.After(time.Second):
+			close(release)
+			t.Fatalf("Expected the matrix and the KVM to be swapping at the same time, only %v started", inside)
+		}
+	}
+	close(release)
+
+	result := <-results
+	if len(result.Actions) != 4 {
+		t.Fatalf("Expected a result for each action (except the barrier), got %v", result.Actions)
+	}
+	for i, expected := range []string{"01-01", "02-02", "2", "3"} {
+		if result.Actions[i].Action.PerformAction != expected || result.Actions[i].Status != ActionPerformed {
+			t.Errorf("Expected result %d to be %s performed, got %v", i, expected, result.Actions[i])
+		}
+	}
+}
+
+func TestEffectRollsBackAfterAFailure(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	matrix.routes["01"] = "01"
+	matrix.routes["02"] = "02"
+	kvm.current = "2"
+	matrix.failOn = "02-04"
+
+	layout := BuildLayout()
+	layout.Rollback = true
+	actions := []Action{
+		{DriverName: "matrix", PerformAction: "01-03"},
+		{DriverName: "matrix", PerformAction: "02-04"},
+		{Barrier: true},
+		{DriverName: "kvm", PerformAction: "4"},
+	}
+	result := layout.Effect(&actions)
+
+	if result.Success || result.Error == "" {
+		t.Errorf("Expected the result to say that an action failed, got %v", result)
+	}
+	expected := []ActionStatus{ActionPerformed, ActionFailed, ActionCancelled}
+	for i, status := range expected {
+		if result.Actions[i].Status != status {
+			t.Errorf("Expected action %d to be %s, got %s", i, status, result.Actions[i].Status)
+		}
+	}
+
+	if len(result.RolledBack) != 1 || result.RolledBack[0].Action.PerformAction != "01-01" {
+		t.Errorf("Expected output 01 to be put back to input 01, got %v", result.RolledBack)
+	}
+	if matrix.routes["01"] != "01" || len(kvm.sent) != 0 {
+		t.Errorf("Expected the desk to be left how it was, got matrix: %v kvm: %v", matrix.routes, kvm.sent)
+	}
+}
+
+func TestEffectPerformsSteps(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+
+	hooks := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(matrix.sent) != 1 || len(kvm.sent) != 0 {
+			t.Errorf("Expected the hook to be called after the matrix, before the KVM. matrix: %v kvm: %v", matrix.sent, kvm.sent)
+		}
+		hooks++
+	}))
+	defer server.Close()
+
+	actions := []Action{
+		{DriverName: "matrix", PerformAction: "01-03"},
+		{Sleep: &SleepAction{Milliseconds: 20}},
+		{HTTP: &HTTPAction{URL: server.URL}},
+		{DriverName: "kvm", PerformAction: "4"},
+		{Shell: &ShellAction{Command: "false"}},
+		{DriverName: "kvm", PerformAction: "1"},
+	}
+
+	started := time.Now()
+	result := BuildLayout().Effect(&actions)
+	if time.Since(started) < 20*time.Millisecond {
+		t.Errorf("Expected Effect to sleep")
+	}
+
+	expected := []ActionStatus{ActionPerformed, ActionPerformed, ActionPerformed, ActionPerformed, ActionFailed, ActionCancelled}
+	for i, status := range expected {
+		if result.Actions[i].Status != status {
+			t.Errorf("Expected action %d to be %s, got %s (%s)", i, status, result.Actions[i].Status, result.Actions[i].Reason)
+		}
+	}
+	if hooks != 1 {
+		t.Errorf("Expected the hook to be called once, got %d", hooks)
+	}
+}
+
+// fakeInputs is a matrix that knows which of its inputs have a source connected.
+type fakeInputs struct {
+	*fakeMatrix
+	active map[string]bool
+}
+
+func (f *fakeInputs) InputActive(inputName string) (bool, bool) {
+	active, known := f.active[inputName]
+	return active, known
+}
+
+func TestEffectChecksConditions(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	inputs := &fakeInputs{fakeMatrix: matrix, active: map[string]bool{"03": false, "01": true}}
+	Drivers.Drivers[0] = inputs
+
+	inactive := false
+	layout := BuildLayout()
+	layout.Scenes = append(layout.Scenes, Scene{
+		Name:    "fallback",
+		When:    &Condition{DriverName: "matrix", Input: "01", Active: &inactive},
+		Actions: []Action{{DriverName: "kvm", PerformAction: "3"}},
+		Else:    []Action{{DriverName: "kvm", PerformAction: "1"}},
+	})
+
+	actions := []Action{{
+		DriverName:    "matrix",
+		PerformAction: "01-03",
+		When:          &Condition{DriverName: "matrix", Input: "03"},
+		Else:          []Action{{DriverName: "matrix", PerformAction: "01-01"}},
+	}, {
+		Scene: "fallback",
+	}}
+	result := layout.Effect(&actions)
+
+	if len(matrix.sent) != 1 || matrix.sent[0] != "01-01" {
+		t.Errorf("Expected the else route to be used when input 03 is not active, got %v", matrix.sent)
+	}
+	if len(kvm.sent) != 1 || kvm.sent[0] != "1" {
+		t.Errorf("Expected the else action of the scene to be used when input 01 is active, got %v", kvm.sent)
+	}
+	if len(result.Skipped()) != 1 || result.Skipped()[0].PerformAction != "01-03" {
+		t.Errorf("Expected the action with the condition to be skipped, got %v", result.Actions)
+	}
+}
+
+// refreshingInputs counts how many times it is asked to refresh its inputs.
+type refreshingInputs struct {
+	*fakeInputs
+	refreshes int
+}
+
+func (f *refreshingInputs) GetStatus() { f.refreshes++ }
+
+func TestWaitForDoesNotFloodTheDriver(t *testing.T) {
+	matrix, _ := useFakeDrivers()
+	matrix.running = true
+	inputs := &refreshingInputs{fakeInputs: &fakeInputs{fakeMatrix: matrix, active: map[string]bool{"03": false}}}
+	Drivers.Drivers[0] = inputs
+
+	wait := WaitForAction{DriverName: "matrix", Input: "03", Timeout: 3 * waitForInterval}
+	if err := wait.perform(); err == nil {
+		t.Error("Expected waiting for an input that never becomes active to fail")
+	}
+	if inputs.refreshes != 1 {
+		t.Errorf("Expected the driver to be asked to refresh once, got %d", inputs.refreshes)
+	}
+}
+
+// statusInputs is a matrix whose inputs change when it is asked for its status (eg, a source was turned off).
+type statusInputs struct {
+	*fakeInputs
+	fresh map[string]bool
+	read  time.Time
+}
+
+func (f *statusInputs) GetStatus() {
+	f.active = f.fresh
+	f.read = time.Now()
+}
+
+func (f *statusInputs) StatusRead() time.Time { return f.read }
+
+func TestConditionsUseAFreshStatus(t *testing.T) {
+	matrix, _ := useFakeDrivers()
+	matrix.running = true
+	Drivers.Drivers[0] = &statusInputs{
+		fakeInputs: &fakeInputs{fakeMatrix: matrix, active: map[string]bool{"03": true}},
+		fresh:      map[string]bool{"03": false},
+	}
+
+	condition := Condition{DriverName: "matrix", Input: "03"}
+	if condition.met() {
+		t.Error("Expected the condition to use the status from after input 03 was turned off")
+	}
+
+	unknown := Condition{DriverName: "matrix", Input: "04"}
+	if unknown.met() {
+		t.Error("Expected a condition on an input the driver does not know about to not be met")
+	}
+}
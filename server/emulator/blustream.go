@@ -0,0 +1,112 @@
+package emulator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// blustreamSwap is the command to show an input on an output (eg, OUT01FR02).
+var blustreamSwap = regexp.MustCompile(`^OUT(\d+)FR(\d+)$`)
+
+// Blustream speaks the dialect of a Blustream CMX44AB matrix: STATUS prints the state of the inputs & outputs, and
+// OUTxxFRyy shows input yy on output xx. Commands are echoed after the model's prompt (eg, "CMX44AB> STATUS").
+type Blustream struct {
+	Model   string
+	Version string
+
+	lock   sync.Mutex
+	inputs int
+	// routes are the input (from 1) that each output is showing.
+	routes []int
+	// disconnected are the inputs that do not have a source plugged in to them.
+	disconnected map[int]bool
+}
+
+// NewBlustream creates a matrix with the given number of inputs & outputs (eg, 4x4 or 8x8).
+// Each output starts out showing the input with the same number, and every input has a source plugged in.
+func NewBlustream(inputs, outputs int) *Blustream {
+	b := &Blustream{
+		Model:        fmt.Sprintf("CMX%d%dAB", inputs, outputs),
+		Version:      "2.22",
+		inputs:       inputs,
+		routes:       make([]int, outputs),
+		disconnected: map[int]bool{},
+	}
+	for i := range b.routes {
+		b.routes[i] = i%inputs + 1
+	}
+	return b
+}
+
+// SetConnected plugs a source in to an input (from 1), or unplugs it. STATUS reports it in the HDMIcon column.
+func (b *Blustream) SetConnected(input int, connected bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.disconnected[input] = !connected
+}
+
+// Route returns the input that an output (both from 1) is showing.
+func (b *Blustream) Route(output int) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.routes[output-1]
+}
+
+// Respond answers a command the same way the matrix does.
+func (b *Blustream) Respond(command string) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	response := b.Model + "> " + command + "\r\n"
+	command = strings.ToUpper(command)
+	switch {
+	case command == "STATUS":
+		response += b.status()
+	case blustreamSwap.MatchString(command):
+		match := blustreamSwap.FindStringSubmatch(command)
+		output, _ := strconv.Atoi(match[1])
+		input, _ := strconv.Atoi(match[2])
+		if output < 1 || output > len(b.routes) || input < 1 || input > b.inputs {
+			response += "[ERROR]Invalid parameter.\r\n"
+			break
+		}
+		b.routes[output-1] = input
+		response += fmt.Sprintf("[SUCCESS]Set output %02d connect from input %02d.\r\n", output, input)
+	default:
+		response += "[ERROR]Invalid command.\r\n"
+	}
+	return response
+}
+
+// status is the table that STATUS prints (see status-response.txt in the driver).
+func (b *Blustream) status() string {
+	onOff := func(on bool) string {
+		if on {
+			return "On"
+		}
+		return "Off"
+	}
+
+	lines := []string{
+		strings.Repeat("=", 64),
+		"              HDMI " + b.Model + " Status",
+		"              FW Version: " + b.Version,
+		"",
+		"Power   IR      Key     Beep",
+		"On      On      On      Off",
+		"",
+		"Input   Edid         HDMIcon",
+	}
+	for input := 1; input <= b.inputs; input++ {
+		lines = append(lines, fmt.Sprintf("%02d      Force___11   %s", input, onOff(!b.disconnected[input])))
+	}
+	lines = append(lines, "", "Output  FromIn       HDMIcon   OutputEn    OSP   Mute")
+	for output, input := range b.routes {
+		lines = append(lines, fmt.Sprintf("%02d      %02d           On        Yes         SNK   Off", output+1, input))
+	}
+	lines = append(lines, strings.Repeat("=", 64))
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
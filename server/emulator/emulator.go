@@ -0,0 +1,91 @@
+// Package emulator pretends to be the devices that Fence has drivers for, so the drivers can be tried out (and
+// tested) without the hardware. Emulators can be reached over TCP, or over a pty that looks like a serial port.
+package emulator
+
+import (
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// Device is a device that can be emulated.
+type Device interface {
+	// Respond returns what the device sends back after receiving a command (including any echo & line endings).
+	Respond(command string) string
+}
+
+// Announcer is a device that also sends things without being asked (eg, when a button on its front is pressed).
+type Announcer interface {
+	Device
+
+	// Announcements returns what the device sends without being asked, and a function to stop receiving them.
+	Announcements() (<-chan string, func())
+}
+
+// Serve answers the commands sent over conn until it is closed.
+func Serve(device Device, conn io.ReadWriter) error {
+	var writing sync.Mutex
+	write := func(s string) error {
+		writing.Lock()
+		defer writing.Unlock()
+		_, err := io.WriteString(conn, s)
+		return err
+	}
+
+	if announcer, ok := device.(Announcer); ok {
+		announcements, stop := announcer.Announcements()
+		defer stop()
+		go func() {
+			for announcement := range announcements {
+				write(announcement)
+			}
+		}()
+	}
+
+	lines := drivers.NewLineReader(conn, "\r\n", "\r", "\n")
+	for {
+		command, err := lines.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		if err := write(device.Respond(command)); err != nil {
+			return err
+		}
+	}
+}
+
+// Listen accepts connections on address (eg, 127.0.0.1:2323), serving each of them until the listener is closed.
+func Listen(device Device, address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := Serve(device, conn); err != nil {
+					log.Printf("[emulator]: %s: %s", conn.RemoteAddr(), err)
+				}
+			}()
+		}
+	}()
+	return listener, nil
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package emulator
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Pty is a pseudo-terminal that a driver can open as if it were a serial port.
+type Pty struct {
+	// Name is the path a driver uses as its serial_device (eg, /dev/pts/3).
+	Name string
+
+	master *os.File
+	// slave is kept open, so reading from the master waits for a driver instead of failing when none is connected.
+	slave *os.File
+}
+
+// OpenPty creates a pty, and serves device on it until it is closed.
+func OpenPty(device Device) (*Pty, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var number uint32
+	if err := ioctl(master, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("could not find the name of the pty: %w", err)
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("could not unlock the pty: %w", err)
+	}
+
+	pty := &Pty{Name: fmt.Sprintf("/dev/pts/%d", number), master: master}
+	pty.slave, err = os.OpenFile(pty.Name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	if err := makeRaw(pty.slave); err != nil {
+		pty.Close()
+		return nil, err
+	}
+
+	go Serve(device, master)
+	return pty, nil
+}
+
+// Close stops serving the device, and removes the pty.
+func (p *Pty) Close() error {
+	p.slave.Close()
+	return p.master.Close()
+}
+
+// makeRaw turns off echo & line editing, so what is written to the pty arrives as it was sent (like a serial port).
+func makeRaw(f *os.File) error {
+	var termios syscall.Termios
+	if err := ioctl(f, syscall.TCGETS, uintptr(unsafe.Pointer(&termios))); err != nil {
+		return err
+	}
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	return ioctl(f, syscall.TCSETS, uintptr(unsafe.Pointer(&termios)))
+}
+
+// ioctl uses the file's descriptor without calling Fd, which would stop Close from interrupting a Read.
+func ioctl(f *os.File, request, arg uintptr) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg)
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
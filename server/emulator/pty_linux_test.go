@@ -0,0 +1,31 @@
+package emulator
+
+import (
+	"bufio"
+	"os"
+	"testing"
+)
+
+func TestBlustreamOverPty(t *testing.T) {
+	pty, err := OpenPty(NewBlustream(4, 4))
+	if err != nil {
+		t.Skipf("Could not create a pty: %s", err)
+	}
+	defer pty.Close()
+
+	port, err := os.OpenFile(pty.Name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+
+	if _, err := port.WriteString("OUT02FR04\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	responses := bufio.NewReader(port)
+	for _, expected := range []string{"CMX44AB> OUT02FR04\r\n", "[SUCCESS]Set output 02 connect from input 04.\r\n"} {
+		if line, err := responses.ReadString('\n'); line != expected {
+			t.Errorf("Expected %q, got %q (%v)", expected, line, err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package emulator
+
+import "errors"
+
+// Pty is a pseudo-terminal that a driver can open as if it were a serial port.
+type Pty struct {
+	Name string
+}
+
+// OpenPty is only available on Linux, use Listen (and a tcp transport) instead.
+func OpenPty(device Device) (*Pty, error) {
+	return nil, errors.New("ptys can only be created on linux, use -listen instead")
+}
+
+// Close does nothing, as a pty can't be created.
+func (p *Pty) Close() error {
+	return nil
+}
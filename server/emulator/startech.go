@@ -0,0 +1,104 @@
+package emulator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// startechSwap is the command to swap the KVM to a port (eg, K1P2).
+var startechSwap = regexp.MustCompile(`^K1P(\d+)$`)
+
+// StartechBanner is what the KVM prints after it has been powered on.
+const StartechBanner = "SV431DVIUDDM F/W Version :H2K B4.1"
+
+// Startech speaks the dialect of a Startech SV431DVIUDDM KVM: K1Pn swaps to port n, and the KVM replies with CHn.
+// The KVM also sends CHn when a button on its front is pressed. Anything it does not understand gets ERROR, and the
+// first reply after it has been powered on is followed by its banner.
+type Startech struct {
+	lock    sync.Mutex
+	ports   int
+	current int
+	booted  bool
+
+	// listeners receive what the KVM sends without being asked.
+	listeners map[int]chan string
+	nextID    int
+}
+
+// NewStartech creates a KVM with the given number of ports, starting on port 1.
+func NewStartech(ports int) *Startech {
+	return &Startech{ports: ports, current: 1, listeners: map[int]chan string{}}
+}
+
+// Current returns the port that the KVM is on.
+func (s *Startech) Current() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.current
+}
+
+// Press presses the button on the front of the KVM for a port, which swaps to it and sends CHn to everyone connected.
+func (s *Startech) Press(port int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if port < 1 || port > s.ports {
+		return
+	}
+
+	s.current = port
+	for _, listener := range s.listeners {
+		select {
+		case listener <- fmt.Sprintf("CH%d\r\n", port):
+		default:
+		}
+	}
+}
+
+// PowerCycle turns the KVM off and on again, so its banner is sent after the next reply.
+func (s *Startech) PowerCycle() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.booted = false
+	s.current = 1
+}
+
+// Respond answers a command the same way the KVM does.
+func (s *Startech) Respond(command string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	response := "ERROR\r\n"
+	if match := startechSwap.FindStringSubmatch(strings.ToUpper(command)); match != nil {
+		if port, _ := strconv.Atoi(match[1]); port >= 1 && port <= s.ports {
+			s.current = port
+			response = fmt.Sprintf("CH%d\r\n", port)
+		}
+	}
+
+	if !s.booted {
+		s.booted = true
+		response += StartechBanner + "\r\n"
+	}
+	return response
+}
+
+// Announcements returns the CHn messages sent when a button is pressed.
+func (s *Startech) Announcements() (<-chan string, func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	announcements := make(chan string, 16)
+	s.listeners[id] = announcements
+
+	return announcements, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		delete(s.listeners, id)
+		close(announcements)
+	}
+}
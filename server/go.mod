@@ -5,5 +5,7 @@ go 1.17
 require (
 	github.com/gorilla/websocket v1.5.0
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
-	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
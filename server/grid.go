@@ -0,0 +1,50 @@
+package main
+
+// GridPosition is where a computer's screen sits on the desk.
+// X increases to the right, and Y increases towards the bottom (the same as screen coordinates).
+type GridPosition struct {
+	X int `json:"x" yaml:"x"`
+	Y int `json:"y" yaml:"y"`
+}
+
+// neighbour returns the grid position next to this one in the given direction.
+func (p GridPosition) neighbour(direction string) GridPosition {
+	switch direction {
+	case "left":
+		p.X--
+	case "right":
+		p.X++
+	case "top":
+		p.Y--
+	case "bottom":
+		p.Y++
+	}
+	return p
+}
+
+// deriveDirections works out the Directions for every computer that has a grid position.
+// Moving off an edge of a screen performs the Activate actions of the computer next to it on the grid,
+// so moving right from A to B, and then left from B, will always go back to A.
+// Corners are not derived; a corner without actions uses the actions for the edge the mouse crossed (see FindActionsAt).
+// Any direction that has been written by hand is left alone, so it can be used to override the grid.
+func (l *Layout) deriveDirections() {
+	grid := map[GridPosition]*Computer{}
+	for i, computer := range l.Computers {
+		if computer.Grid != nil {
+			grid[*computer.Grid] = &l.Computers[i]
+		}
+	}
+
+	for _, computer := range grid {
+		for _, direction := range edgeNames {
+			actions := computer.Directions.actionsFor(direction)
+			if len(*actions) > 0 {
+				continue
+			}
+
+			if neighbour, exists := grid[computer.Grid.neighbour(direction)]; exists {
+				*actions = append([]Action(nil), neighbour.Activate...)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGridDerivesDirections(t *testing.T) {
+	config, err := loadConfig("config.grid.example.yaml")
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	layout := config.Layout
+
+	tests := []struct {
+		computer  string
+		direction string
+		to        string
+	}{
+		{"work-computer", "right", "home-computer"},
+		{"home-computer", "left", "work-computer"},
+		{"home-computer", "right", "streaming-computer"},
+		{"streaming-computer", "left", "home-computer"},
+	}
+
+	for _, test := range tests {
+		actions, _ := layout.FindActions(test.computer, test.direction)
+		if actions == nil {
+			t.Fatalf("Expected actions moving %s from %s", test.direction, test.computer)
+		}
+
+		for _, computer := range layout.Computers {
+			if computer.Name == test.to && !reflect.DeepEqual(*actions, computer.Activate) {
+				t.Errorf("Moving %s from %s should activate %s, got %v", test.direction, test.computer, test.to, *actions)
+			}
+		}
+	}
+
+	if actions, _ := layout.FindActions("work-computer", "left"); actions != nil {
+		t.Errorf("There is nothing to the left of work-computer, got %v", *actions)
+	}
+	for _, computer := range layout.Computers {
+		if len(computer.Directions.TopRight) > 0 || len(computer.Directions.BottomRight) > 0 {
+			t.Errorf("Expected the grid to leave the corners of %s alone, got %+v", computer.Name, computer.Directions)
+		}
+	}
+}
+
+func TestGridDirectionsCanBeOverridden(t *testing.T) {
+	config, err := parseConfig([]byte(`layout:
+  computers:
+    - name: pc1
+      grid: {x: 0, y: 0}
+      activate: [{driver: kvm, action: "1"}]
+      directions:
+        right: [{driver: kvm, action: "3"}]
+    - name: pc2
+      grid: {x: 1, y: 0}
+      activate: [{driver: kvm, action: "2"}]
+    - name: pc3
+      grid: {x: 0, y: 1}
+      activate: [{driver: kvm, action: "3"}]
+`))
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	right, _ := config.Layout.FindActions("pc1", "right")
+	bottom, _ := config.Layout.FindActions("pc1", "bottom")
+	if (*right)[0].PerformAction != "3" || (*bottom)[0].PerformAction != "3" {
+		t.Errorf("Expected the hand-written right action to be kept, got right: %v bottom: %v", *right, *bottom)
+	}
+}
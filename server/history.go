@@ -0,0 +1,207 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxHistory is how many routing states are remembered for undo.
+const maxHistory = 20
+
+// HistoryEntry is how the drivers were routed before some actions were performed.
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+
+	// Description says what was done after this state (eg, "home-computer: left").
+	Description string `json:"description"`
+
+	// Computer is the computer that was active (if it was known).
+	Computer string `json:"computer,omitempty"`
+
+	// Routes are the inputs that each output of each driver was showing. Drivers with a single output use "".
+	Routes RoutingState `json:"routes"`
+}
+
+// RoutingHistory remembers the routing states before each set of actions, so they can be undone.
+type RoutingHistory struct {
+	lock    sync.Mutex
+	entries []HistoryEntry
+	active  string
+}
+
+// History is the routing history of the server.
+var History = &RoutingHistory{}
+
+// HistoryStatus is what /history shows.
+type HistoryStatus struct {
+	ActiveComputer string `json:"active_computer,omitempty"`
+	// Entries are newest first.
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// Status returns the active computer, and the states that can be gone back to (newest first).
+func (h *RoutingHistory) Status() HistoryStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	status := HistoryStatus{ActiveComputer: h.active, Entries: []HistoryEntry{}}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		status.Entries = append(status.Entries, h.entries[i])
+	}
+	return status
+}
+
+// push remembers a routing state, forgetting the oldest one if there are too many.
+func (h *RoutingHistory) push(entry HistoryEntry, computer string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	entry.Computer = h.active
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+	if computer != "" {
+		h.active = computer
+	}
+}
+
+// pop removes the newest routing state.
+func (h *RoutingHistory) pop() (HistoryEntry, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.entries) == 0 {
+		return HistoryEntry{}, false
+	}
+	entry := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return entry, true
+}
+
+// setActive records which computer is active, without remembering a routing state.
+func (h *RoutingHistory) setActive(computer string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.active = computer
+}
+
+// effectLock makes sure only one set of actions (or an undo) is performed at a time, so the routes that are remembered
+// are not changed by someone else part way through.
+var effectLock sync.Mutex
+
+// effectWithHistory performs actions with Effect, remembering how the drivers were routed beforehand so the actions
+// can be undone. Nothing is remembered if the actions did not change anything.
+func (l *Layout) effectWithHistory(actions *[]Action, description string) *EffectResult {
+	return l.effectOnlyWithHistory(actions, description, nil)
+}
+
+// effectOnlyWithHistory is effectWithHistory for just the actions that only returns true for (see effectOnly).
+func (l *Layout) effectOnlyWithHistory(actions *[]Action, description string, only func(Action) bool) *EffectResult {
+	effectLock.Lock()
+	defer effectLock.Unlock()
+
+	if actions == nil || len(*actions) == 0 {
+		return l.effectOnly(actions, only)
+	}
+
+	before := currentRoutes()
+	result := l.effectOnly(actions, only)
+	if !result.changedSomething() {
+		return result
+	}
+
+	computer := ""
+	if result.Success {
+		computer = l.activeComputer(result)
+	}
+	History.push(HistoryEntry{Time: time.Now(), Description: description, Routes: before}, computer)
+	return result
+}
+
+// Undo puts the drivers back to how they were routed before the last set of actions.
+// Undo returns nil if there is nothing to undo.
+func (l *Layout) Undo() *EffectResult {
+	effectLock.Lock()
+	defer effectLock.Unlock()
+
+	entry, ok := History.pop()
+	if !ok {
+		return nil
+	}
+
+	log.Printf("[history]: Undoing %s", entry.Description)
+	result := l.Effect(entry.Routes.actions())
+	History.setActive(entry.Computer)
+	return result
+}
+
+// changedSomething checks if any of the actions were performed (or failed part way through).
+func (r *EffectResult) changedSomething() bool {
+	for _, result := range r.Actions {
+		if result.Status == ActionPerformed || result.Status == ActionFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// activeComputer works out which computer is active once result's actions have been performed, from how the drivers
+// are routed: drivers that know what they are showing are asked, and the routes that were performed are used for the
+// rest. Like the layout check, the computer whose activate actions make those routes is active (see identify).
+func (l *Layout) activeComputer(result *EffectResult) string {
+	state := currentRoutes()
+	for _, performed := range result.Actions {
+		driver := findDriver(performed.Action.DriverName)
+		if performed.Status != ActionPerformed || driver == nil {
+			continue
+		}
+		routes, err := performed.Action.routes(driver)
+		if err != nil {
+			continue
+		}
+		for _, route := range routes {
+			if route.Layer == "" {
+				state.set(performed.Action.DriverName, route.Output, route.Input)
+			}
+		}
+	}
+
+	driverList := registeredDrivers()
+	targets := map[string]RoutingState{}
+	for _, computer := range l.Computers {
+		if len(computer.Activate) == 0 {
+			continue
+		}
+		if target, err := l.simulate(computer.Activate, RoutingState{}, driverList); err == nil {
+			targets[computer.Name] = target
+		}
+	}
+	return identify(state, targets)
+}
+
+// actions returns the actions that would route the drivers back to this state.
+func (r RoutingState) actions() *[]Action {
+	var driverNames []string
+	for driverName := range r {
+		driverNames = append(driverNames, driverName)
+	}
+	sort.Strings(driverNames)
+
+	var actions []Action
+	for _, driverName := range driverNames {
+		outputs := r[driverName]
+		var outputNames []string
+		for output := range outputs {
+			outputNames = append(outputNames, output)
+		}
+		sort.Strings(outputNames)
+
+		for _, output := range outputNames {
+			actions = append(actions, Action{DriverName: driverName, Input: outputs[output], Output: output})
+		}
+	}
+	return &actions
+}
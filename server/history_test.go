@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUndoRestoresThePreviousRouting(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	Drivers.Drivers[0] = listedMatrix{matrix}
+	History = &RoutingHistory{}
+
+	matrix.routes["01"] = "01"
+	matrix.routes["02"] = "02"
+	matrix.routes["03"] = "03"
+	kvm.current = "1"
+
+	layout := BuildLayout()
+	actions, _ := layout.ActivateActions("streaming-computer")
+	layout.effectWithHistory(actions, "activate streaming-computer")
+
+	status := History.Status()
+	if status.ActiveComputer != "streaming-computer" || len(status.Entries) != 1 {
+		t.Fatalf("Expected streaming-computer to be active with one entry in the history, got %v", status)
+	}
+	if matrix.routes["01"] != "03" || kvm.current != "4" {
+		t.Fatalf("Expected the streaming scene to be routed, got matrix: %v kvm: %s", matrix.routes, kvm.current)
+	}
+
+	result := layout.Undo()
+	if result == nil || !result.Success {
+		t.Fatalf("Expected undo to work, got %v", result)
+	}
+	expected := map[string]string{"01": "01", "02": "02", "03": "03"}
+	for output, input := range expected {
+		if matrix.routes[output] != input {
+			t.Errorf("Expected output %s to be back on input %s, got %s", output, input, matrix.routes[output])
+		}
+	}
+	if kvm.current != "1" {
+		t.Errorf("Expected the KVM to be back on input 1, got %s", kvm.current)
+	}
+	if len(History.Status().Entries) != 0 || layout.Undo() != nil {
+		t.Errorf("Expected there to be nothing left to undo")
+	}
+
+	// Actions that don't change anything are not remembered.
+	layout.effectWithHistory(&[]Action{{DriverName: "kvm", PerformAction: "1"}}, "kvm 1")
+	if len(History.Status().Entries) != 0 {
+		t.Errorf("Expected actions that did nothing to be left out of the history")
+	}
+}
+
+func TestHistoryFindsTheActiveComputerFromTheRoutes(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	Drivers.Drivers[0] = listedMatrix{matrix}
+	History = &RoutingHistory{}
+
+	matrix.routes["01"] = "01"
+	matrix.routes["02"] = "02"
+	kvm.current = "2"
+
+	// These are not the streaming computer's activate actions, but they route the desk the same way.
+	layout := BuildLayout()
+	layout.effectWithHistory(&[]Action{
+		{DriverName: "matrix", Output: "01", Input: "03"},
+		{DriverName: "matrix", PerformAction: "02-04"},
+		{DriverName: "kvm", Input: "4"},
+	}, "by hand")
+	if active := History.Status().ActiveComputer; active != "streaming-computer" {
+		t.Errorf("Expected streaming-computer to be active, got %q", active)
+	}
+
+	// Only the KVM changes, the matrix is still showing what it was.
+	layout.effectWithHistory(&[]Action{{DriverName: "kvm", PerformAction: "1"}}, "work-computer")
+	if active := History.Status().ActiveComputer; active != "work-computer" {
+		t.Errorf("Expected work-computer to be active, got %q", active)
+	}
+}
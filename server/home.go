@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// homeStartTimeout is how long to wait for a driver to start, before giving up on sending it home.
+const homeStartTimeout = 15 * time.Second
+
+// homeStartInterval is how often a driver is checked to see if it has started.
+const homeStartInterval = 250 * time.Millisecond
+
+// goHome performs the actions from the home scene for the drivers that can't tell us what they are doing when they
+// start (see SupportsInitState). Once they have been sent home, the server knows what they are showing.
+// Each driver is given until homeStartTimeout to start, and drivers that start later are sent home when they connect
+// (see goHomeOnConnect).
+func goHome(layout *Layout, started []drivers.DriverInterface) {
+	if layout.HomeScene == "" {
+		return
+	}
+
+	needsHome := map[string]bool{}
+	for _, driver := range started {
+		if driver.SupportsInitState() {
+			continue
+		}
+		if !waitUntilRunning(driver) {
+			log.Printf("[home]: [%s] did not start, it will be sent home once it connects", driver.GetShortName())
+			continue
+		}
+		needsHome[driver.GetShortName()] = true
+	}
+	if len(needsHome) == 0 {
+		return
+	}
+
+	// Conditions are checked (and scenes expanded) as the home scene is performed, like any other scene.
+	// Steps (eg, sleep) and the actions for the other drivers are left out.
+	log.Printf("[home]: Sending %d driver(s) home with scene [%s]", len(needsHome), layout.HomeScene)
+	result := layout.effectOnlyWithHistory(&[]Action{{Scene: layout.HomeScene}}, "home scene "+layout.HomeScene, func(action Action) bool {
+		return !action.isStep() && needsHome[action.DriverName]
+	})
+	if !result.Success {
+		log.Printf("[home]: Could not send drivers home: %s", result.Error)
+	}
+}
+
+// goHomeOnConnect sends a driver home when it connects to its device again (or for the first time, if it was not
+// running when the server started). The device may have been changed while the server could not talk to it.
+func goHomeOnConnect(event drivers.Event) {
+	if event.State != drivers.Connected {
+		return
+	}
+	if driver := findDriver(event.Driver); driver != nil {
+		go goHome(TheLayout(), []drivers.DriverInterface{driver})
+	}
+}
+
+// waitUntilRunning waits for a driver to start, returning false if it has not started within homeStartTimeout.
+func waitUntilRunning(driver drivers.DriverInterface) bool {
+	deadline := time.Now().Add(homeStartTimeout)
+	for !driver.IsRunning() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(homeStartInterval)
+	}
+	return true
+}
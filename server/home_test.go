@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// statelessKvm is a KVM that can't tell us what it is showing when it starts.
+type statelessKvm struct {
+	*fakeKvm
+}
+
+func (s statelessKvm) SupportsInitState() bool { return false }
+
+func TestGoHomeOnlySendsDriversWithoutState(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	kvm.running = true
+	Drivers.Drivers[1] = statelessKvm{kvm}
+
+	layout := BuildLayout()
+	layout.HomeScene = "home"
+	goHome(layout, registeredDrivers())
+
+	if len(kvm.sent) != 1 || kvm.sent[0] != "2" {
+		t.Errorf("Expected the KVM to be sent to input 2, got %v", kvm.sent)
+	}
+	if len(matrix.sent) != 0 {
+		t.Errorf("Expected the matrix to be left alone (it can tell us its state), got %v", matrix.sent)
+	}
+}
+
+func TestGoHomeLooksThroughConditions(t *testing.T) {
+	matrix, kvm := useFakeDrivers()
+	kvm.running = true
+	Drivers.Drivers[0] = &fakeInputs{fakeMatrix: matrix, active: map[string]bool{"03": false, "01": true}}
+	Drivers.Drivers[1] = statelessKvm{kvm}
+
+	inactive := false
+	layout := BuildLayout()
+	layout.HomeScene = "conditional-home"
+	layout.Scenes = append(layout.Scenes, Scene{
+		Name:    "fallback",
+		When:    &Condition{DriverName: "matrix", Input: "01", Active: &inactive},
+		Actions: []Action{{DriverName: "kvm", PerformAction: "3"}},
+		Else:    []Action{{DriverName: "kvm", PerformAction: "1"}},
+	}, Scene{
+		Name: "conditional-home",
+		Actions: []Action{{
+			DriverName:    "matrix",
+			PerformAction: "01-03",
+			When:          &Condition{DriverName: "matrix", Input: "03"},
+			Else:          []Action{{Scene: "fallback"}},
+		}},
+	})
+	goHome(layout, registeredDrivers())
+
+	if len(kvm.sent) != 1 || kvm.sent[0] != "1" {
+		t.Errorf("Expected the KVM to be sent home by the else actions, got %v", kvm.sent)
+	}
+	if len(matrix.sent) != 0 {
+		t.Errorf("Expected the matrix to be left alone (it can tell us its state), got %v", matrix.sent)
+	}
+}
+
+func TestGoHomeWhenADriverConnects(t *testing.T) {
+	_, kvm := useFakeDrivers()
+	kvm.running = true
+	Drivers.Drivers[1] = statelessKvm{kvm}
+
+	layout := BuildLayout()
+	layout.HomeScene = "home"
+	generateLayout(&Config{Layout: *layout})
+
+	goHomeOnConnect(drivers.Event{Driver: "kvm", State: drivers.Disconnected})
+	goHomeOnConnect(drivers.Event{Driver: "kvm", State: drivers.Connected})
+	for wait := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		// The KVM is sent home while effectLock is held.
+		effectLock.Lock()
+		sent := append([]string(nil), kvm.sent...)
+		effectLock.Unlock()
+
+		if len(sent) > 0 {
+			if len(sent) != 1 || sent[0] != "2" {
+				t.Errorf("Expected the KVM to be sent to input 2 once, got %v", sent)
+			}
+			return
+		}
+		if time.Since(wait) > 2*time.Second {
+			t.Fatal("The KVM was not sent home when it connected")
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -24,7 +25,26 @@ func serveHome(w http.ResponseWriter, r *http.Request) {
 func serveLayout(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL)
 	w.Header().Add("Content-Type", "application/json")
-	_, err := w.Write(JSONLayout)
+	_, err := w.Write(JSONLayout())
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func serveLayoutValidate(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	w.Header().Add("Content-Type", "application/json")
+
+	issues := TheLayout().Validate(registeredDrivers())
+	response, _ := json.Marshal(struct {
+		Valid  bool             `json:"valid"`
+		Issues ValidationIssues `json:"issues"`
+	}{
+		Valid:  !issues.HasErrors(),
+		Issues: issues,
+	})
+
+	_, err := w.Write(response)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -34,7 +54,9 @@ func serveDriverStatus(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL)
 	w.Header().Add("Content-Type", "application/json")
 
+	driversLock.RLock()
 	drivers, _ := json.Marshal(Drivers)
+	driversLock.RUnlock()
 
 	_, err := w.Write(drivers)
 	if err != nil {
@@ -44,14 +66,134 @@ func serveDriverStatus(w http.ResponseWriter, r *http.Request) {
 
 func serveRefreshStatus(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL)
-	for _, driver := range Drivers.Drivers {
+	for _, driver := range registeredDrivers() {
 		driver.GetStatus()
 	}
 }
 
+func serveConfigStatus(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	w.Header().Add("Content-Type", "application/json")
+
+	status, _ := json.Marshal(currentConfigStatus())
+
+	_, err := w.Write(status)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// serveLayoutCheck simulates every direction of every computer, to find dead-ends & directions that don't lead back.
+func serveLayoutCheck(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	writeJSON(w, TheLayout().Analyse(registeredDrivers()))
+}
+
+// serveScene performs all of the actions in a scene (POST /scenes/{name}).
+func serveScene(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/scenes/")
+	layout := TheLayout()
+	if layout.findScene(name) == nil {
+		http.Error(w, "Scene not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, layout.effectWithHistory(&[]Action{{Scene: name}}, "scene "+name))
+}
+
+// serveActivate makes a computer the active machine (POST /computers/{name}/activate).
+func serveActivate(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/computers/"), "/")
+	if len(path) != 2 || path[1] != "activate" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	layout := TheLayout()
+	actions, err := layout.ActivateActions(path[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, layout.effectWithHistory(actions, "activate "+path[0]))
+}
+
+// serveUndo puts the drivers back to how they were before the last switch (POST /undo).
+func serveUndo(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result := TheLayout().Undo()
+	if result == nil {
+		http.Error(w, "There is nothing to undo", http.StatusConflict)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// serveHistory shows the routing states that can be gone back to, newest first.
+func serveHistory(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	writeJSON(w, History.Status())
+}
+
+// writeJSON sends v to the client as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Add("Content-Type", "application/json")
+
+	response, _ := json.Marshal(v)
+	_, err := w.Write(response)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// serveSwapRoute switches an output of a driver to an input (POST /swap/{driver}/{input}/{output}).
+// The output can be left off for drivers with a single output. The input & output can be aliases.
+func serveSwapRoute(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/swap/"), "/")
+	if len(path) < 2 || len(path) > 3 || path[0] == "" || path[1] == "" {
+		http.Error(w, "Expected /swap/{driver}/{input}/{output}", http.StatusNotFound)
+		return
+	}
+	if findDriver(path[0]) == nil {
+		http.Error(w, "Driver not found", http.StatusNotFound)
+		return
+	}
+
+	action := Action{DriverName: path[0], Input: path[1]}
+	if len(path) == 3 {
+		action.Output = path[2]
+	}
+	writeJSON(w, TheLayout().effectWithHistory(&[]Action{action}, fmt.Sprintf("swap %s", strings.Join(path, "/"))))
+}
+
 func serveSwap(w http.ResponseWriter, r *http.Request) {
-	actions, _ := TheLayout.FindActions("home-computer", "left")
-	TheLayout.Effect(actions)
+	layout := TheLayout()
+	actions, _ := layout.FindActions("home-computer", "left")
+	writeJSON(w, layout.effectWithHistory(actions, "home-computer: left"))
 
 	time.Sleep(500 * time.Millisecond)
 }
\ No newline at end of file
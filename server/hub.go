@@ -2,7 +2,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
+
+	"github.com/timgws/kvm-switch/server/drivers"
 )
 
 // Hub maintains the set of active clients and broadcasts messages to the
@@ -12,20 +16,44 @@ type Hub struct {
 	clients map[*Client]bool
 
 	// Inbound messages from the clients.
-	broadcast chan []byte
+	broadcast chan clientMessage
+
+	// Messages from the server (eg, a driver losing its connection) that are sent to every client.
+	// It is buffered, as drivers send their events while the hub may be waiting on them (eg, in SetOutput).
+	outgoing chan []byte
 
 	// Register requests from the clients.
 	register chan *Client
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// Results of the actions that clients asked for, once they have been performed.
+	results chan clientResult
+}
+
+// clientMessage is a message that has been received from a client.
+type clientMessage struct {
+	from *Client
+	data []byte
 }
 
+// clientResult is what happened to the actions that a client asked for.
+type clientResult struct {
+	to     *Client
+	result *EffectResult
+}
+
+// outgoingBuffer is how many messages from the server can wait for the hub to send them.
+const outgoingBuffer = 64
+
 func newHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan clientMessage),
+		outgoing:   make(chan []byte, outgoingBuffer),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		results:    make(chan clientResult),
 		clients:    make(map[*Client]bool),
 	}
 }
@@ -40,25 +68,114 @@ func (h *Hub) run() {
 				delete(h.clients, client)
 				close(client.send)
 			}
-		case message := <-h.broadcast:
+		case incoming := <-h.broadcast:
+			message := incoming.data
 
 			var sd SwapDevice
 			if err := sd.Unmarshal(message); err == nil {
-				actions, _ := TheLayout.FindActions(sd.Device, sd.Direction)
-				TheLayout.Effect(actions)
-				//d, _ := json.Marshal(actions)
-				//log.Printf("%s", d)
+				layout := TheLayout()
+				position := NoPosition
+				if sd.Position != nil {
+					position = *sd.Position
+				}
+				actions, _ := layout.FindActionsAt(sd.Device, sd.Direction, sd.Edge, position)
+				h.perform(incoming.from, func() *EffectResult {
+					return layout.effectWithHistory(actions, fmt.Sprintf("%s: %s", sd.Device, sd.Direction))
+				})
 			}
 
-			fmt.Printf("Clients: %d", len(h.clients))
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+			var ac ActivateComputer
+			if err := ac.Unmarshal(message); err == nil {
+				layout := TheLayout()
+				actions, err := layout.ActivateActions(ac.Computer)
+				if err != nil {
+					log.Printf("Could not activate: %s", err)
+					h.reply(incoming.from, &EffectResult{Success: false, Error: err.Error()})
+				} else {
+					h.perform(incoming.from, func() *EffectResult {
+						return layout.effectWithHistory(actions, "activate "+ac.Computer)
+					})
 				}
 			}
+
+			var undo UndoRouting
+			if err := undo.Unmarshal(message); err == nil {
+				h.perform(incoming.from, func() *EffectResult {
+					if result := TheLayout().Undo(); result != nil {
+						return result
+					}
+					return &EffectResult{Success: false, Error: "there is nothing to undo"}
+				})
+			}
+
+			fmt.Printf("Clients: %d", len(h.clients))
+			h.sendToAll(message)
+		case message := <-h.outgoing:
+			h.sendToAll(message)
+		case done := <-h.results:
+			h.reply(done.to, done.result)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// perform runs effect away from the hub, so clients can still come & go (and hear about drivers) while the actions
+// are performed (eg, a sleep or wait_for). The result is sent back to the client that asked once it is done.
+// effectWithHistory & Undo make sure only one set of actions is performed at a time.
+func (h *Hub) perform(client *Client, effect func() *EffectResult) {
+	go func() {
+		h.results <- clientResult{to: client, result: effect()}
+	}()
+}
+
+// sendToAll sends a message to every client, dropping any client that is not keeping up.
+func (h *Hub) sendToAll(message []byte) {
+	for client := range h.clients {
+		select {
+		case client.send <- message:
+		default:
+			close(client.send)
+			delete(h.clients, client)
+		}
+	}
+}
+
+// announce sends a message from the server to every client.
+func (h *Hub) announce(action BroadcastAction) {
+	message, err := json.Marshal(action)
+	if err != nil {
+		log.Printf("Could not send %s to the clients: %s", action.ActionName, err)
+		return
+	}
+	// Never block the driver that sent this. If the hub is this far behind, the clients miss the message.
+	select {
+	case h.outgoing <- message:
+	default:
+		log.Printf("Could not send %s to the clients, the hub is too busy", action.ActionName)
+	}
+}
+
+// announceDriverEvent tells every client that a driver has lost (or got back) the connection to its device.
+// The action name is driver_disconnected or driver_connected.
+func (h *Hub) announceDriverEvent(event drivers.Event) {
+	h.announce(BroadcastAction{ActionName: "driver_" + string(event.State), Value: event})
+}
+
+// reply tells the client that sent a message what happened to the actions it asked for.
+func (h *Hub) reply(client *Client, result *EffectResult) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	message, err := json.Marshal(BroadcastAction{ActionName: "effect_result", Value: result})
+	if err != nil {
+		log.Printf("Could not send the result to the client: %s", err)
+		return
+	}
+
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(h.clients, client)
+	}
+}
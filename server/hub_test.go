@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHubServesClientsWhileActionsArePerformed(t *testing.T) {
+	useFakeDrivers()
+	generateLayout(&Config{Layout: Layout{Computers: []Computer{{
+		Name:     "slow-computer",
+		Activate: []Action{{Sleep: &SleepAction{Milliseconds: 500}}},
+	}}}})
+
+	hub := newHub()
+	go hub.run()
+
+	asker := &Client{hub: hub, send: make(chan []byte, 8)}
+	hub.register <- asker
+	hub.broadcast <- clientMessage{from: asker, data: []byte(`{"activate": "slow-computer"}`)}
+
+	select {
+	case hub.register <- &Client{hub: hub, send: make(chan []byte, 8)}:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("The hub stopped registering clients while the actions were performed")
+	}
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case message := <-asker.send:
+			if strings.Contains(string(message), `"effect_result"`) {
+				if !strings.Contains(string(message), `"success":true`) {
+					t.Errorf("Expected the actions to succeed, got %s", message)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("The client was not told what happened to its actions")
+		}
+	}
+}
@@ -2,37 +2,104 @@ package main
 
 import (
 	"fmt"
-	"github.com/timgws/kvm-switch/server/drivers"
 	"strings"
 )
 
 // Layout defines where the machines are, and what the actions that will be performed when
 // the mouse is moved around different areas.
 type Layout struct {
-	Computers []Computer
+	Computers []Computer `json:"computers" yaml:"computers"`
+
+	// Scenes are named lists of actions that can be used by any direction.
+	Scenes []Scene `json:"scenes,omitempty" yaml:"scenes,omitempty"`
+
+	// Rollback puts outputs back to what they were showing when an action fails part way through switching.
+	Rollback bool `json:"rollback,omitempty" yaml:"rollback,omitempty"`
+
+	// HomeScene is performed when the server starts, for drivers that can't tell us what they are showing.
+	HomeScene string `json:"home_scene,omitempty" yaml:"home_scene,omitempty"`
 }
 
 // Computer is a computer (or device) that will be swapped on the matrix.
 type Computer struct {
-	Name string
-	Directions Directions
+	Name string `json:"name" yaml:"name"`
+	Directions Directions `json:"directions" yaml:"directions"`
+
+	// Grid is where the computer's screen sits on the desk. See deriveDirections.
+	Grid *GridPosition `json:"grid,omitempty" yaml:"grid,omitempty"`
+
+	// Activate are the actions that make this computer the active machine (eg, the KVM port & matrix routes).
+	Activate []Action `json:"activate,omitempty" yaml:"activate,omitempty"`
 }
 
 // Directions for computers were actions will be performed when moving the mouse between different areas.
 type Directions struct {
-	Left []Action
-	Right []Action
-	Top []Action
-	Bottom []Action
+	Left []Action `json:"left,omitempty" yaml:"left,omitempty"`
+	Right []Action `json:"right,omitempty" yaml:"right,omitempty"`
+	Top []Action `json:"top,omitempty" yaml:"top,omitempty"`
+	Bottom []Action `json:"bottom,omitempty" yaml:"bottom,omitempty"`
+
+	// Corners are hot-zones that clients report separately to the edges (when they have been configured with a corner size).
+	TopLeft []Action `json:"top_left,omitempty" yaml:"top_left,omitempty"`
+	TopRight []Action `json:"top_right,omitempty" yaml:"top_right,omitempty"`
+	BottomLeft []Action `json:"bottom_left,omitempty" yaml:"bottom_left,omitempty"`
+	BottomRight []Action `json:"bottom_right,omitempty" yaml:"bottom_right,omitempty"`
+
+	// Segments split an edge into parts that perform different actions (eg, two machines stacked beside a tall screen).
+	// If the position the mouse left from is not inside a segment, the actions for the whole edge are used.
+	Segments []EdgeSegment `json:"segments,omitempty" yaml:"segments,omitempty"`
+}
+
+// EdgeSegment is a part of a screen edge, between From and To.
+// Positions go from 0.0 to 1.0: top to bottom for the left & right edges, and left to right for the top & bottom edges.
+type EdgeSegment struct {
+	Edge    string   `json:"edge" yaml:"edge"`
+	From    float64  `json:"from" yaml:"from"`
+	To      float64  `json:"to" yaml:"to"`
+	Actions []Action `json:"actions" yaml:"actions"`
+}
+
+// contains checks if a position along the edge is inside this segment.
+func (s EdgeSegment) contains(position float64) bool {
+	return position >= s.From && position <= s.To
 }
 
 // Action defines an individual _thing_ that will happen after an action is performed.
+// An action either tells a driver to do something, performs all of the actions in a scene, or is one of the
+// other kinds of action in actions.go (eg, sleep). Only one kind can be set on each action.
 type Action struct {
-	DriverName string
-	PerformAction string
+	DriverName string `json:"driver,omitempty" yaml:"driver,omitempty"`
+	PerformAction string `json:"action,omitempty" yaml:"action,omitempty"`
+
+	// Input, Output & Outputs can be used instead of PerformAction, to say which side is which.
+	// Output can be "all" to switch every output of a matrix. Drivers with a single output only need Input.
+	Input   string   `json:"input,omitempty" yaml:"input,omitempty"`
+	Output  string   `json:"output,omitempty" yaml:"output,omitempty"`
+	Outputs []string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+
+	// Layer switches just the video, audio or usb of a route, for drivers that can switch them separately.
+	Layer string `json:"layer,omitempty" yaml:"layer,omitempty"`
+
+	// Scene is the name of a scene to perform instead.
+	Scene string `json:"scene,omitempty" yaml:"scene,omitempty"`
+
+	// Barrier waits for every action before it to finish, before any action after it is started.
+	// Actions for different drivers are otherwise performed at the same time.
+	Barrier bool `json:"barrier,omitempty" yaml:"barrier,omitempty"`
+
+	// Sleep, HTTP, Shell & WaitFor don't switch a driver. Like a barrier, everything before them finishes first,
+	// and the actions after them wait for them to finish.
+	Sleep   *SleepAction   `json:"sleep,omitempty" yaml:"sleep,omitempty"`
+	HTTP    *HTTPAction    `json:"http,omitempty" yaml:"http,omitempty"`
+	Shell   *ShellAction   `json:"shell,omitempty" yaml:"shell,omitempty"`
+	WaitFor *WaitForAction `json:"wait_for,omitempty" yaml:"wait_for,omitempty"`
+
+	// When is checked right before the action is performed. If it is not met, the Else actions are performed instead.
+	When *Condition `json:"when,omitempty" yaml:"when,omitempty"`
+	Else []Action   `json:"else,omitempty" yaml:"else,omitempty"`
 }
 
-// BuildLayout should build a layout that is usable by the clients.
+// BuildLayout builds the default layout that is used when no configuration file has been given.
 func BuildLayout() *Layout {
 	return &Layout{
 		Computers: []Computer{{
@@ -43,6 +110,10 @@ func BuildLayout() *Layout {
 					PerformAction: "1",
 				}},
 			},
+			Activate: []Action{{
+				DriverName: "kvm",
+				PerformAction: "1",
+			}},
 		}, {
 			Name: "home-computer",
 			Directions: Directions{
@@ -51,36 +122,77 @@ func BuildLayout() *Layout {
 					PerformAction: "2",
 				}},
 				Right: []Action{{
-					DriverName: "matrix",
-					PerformAction: "01-03",
-				}, {
-					DriverName: "matrix",
-					PerformAction: "02-04",
-				}, {
-					DriverName: "kvm",
-					PerformAction: "4",
+					Scene: "streaming",
 				}},
 			},
+			Activate: []Action{{
+				Scene: "home",
+			}},
 		}, {
 			Name: "streaming-computer",
 			Directions: Directions{
 				Left: []Action{{
-					DriverName: "matrix",
-					PerformAction: "01-01",
-				}, {
-					DriverName: "matrix",
-					PerformAction: "02-02",
-				}, {
-					DriverName: "kvm",
-					PerformAction: "2",
+					Scene: "home",
 				}},
 			},
+			Activate: []Action{{
+				Scene: "streaming",
+			}},
+		}},
+		Scenes: []Scene{{
+			Name: "home",
+			Actions: []Action{{
+				DriverName: "matrix",
+				PerformAction: "01-01",
+			}, {
+				DriverName: "matrix",
+				PerformAction: "02-02",
+			}, {
+				DriverName: "kvm",
+				PerformAction: "2",
+			}},
+		}, {
+			Name: "streaming",
+			Actions: []Action{{
+				DriverName: "matrix",
+				PerformAction: "01-03",
+			}, {
+				DriverName: "matrix",
+				PerformAction: "02-04",
+			}, {
+				DriverName: "kvm",
+				PerformAction: "4",
+			}},
 		}},
 	}
 }
 
+// ActivateActions finds the actions that make a computer the active machine.
+func (l *Layout) ActivateActions(name string) (*[]Action, error) {
+	for i, computer := range l.Computers {
+		if computer.Name == name {
+			if len(computer.Activate) == 0 {
+				return nil, fmt.Errorf("device [%s] does not have any activate actions", name)
+			}
+			return &l.Computers[i].Activate, nil
+		}
+	}
+
+	return nil, fmt.Errorf("device [%s] was not found", name)
+}
+
+// NoPosition is used when a client has not said where along the edge the mouse left the screen.
+const NoPosition = -1.0
+
 // FindActions with a given computer/device, will find the actions that will be performed.
 func (l *Layout) FindActions(name string, direction string) (*[]Action, error) {
+	return l.FindActionsAt(name, direction, "", NoPosition)
+}
+
+// FindActionsAt finds the actions for a computer/device, when the mouse has left the screen at position along the edge.
+// When direction is a corner, edge is the edge that the mouse crossed to leave through it ("" if it is not known), and
+// position is along that edge.
+func (l *Layout) FindActionsAt(name string, direction string, edge string, position float64) (*[]Action, error) {
 	var ourDevice *Computer
 	for i, devices := range l.Computers {
 		if devices.Name == name {
@@ -92,18 +204,15 @@ func (l *Layout) FindActions(name string, direction string) (*[]Action, error) {
 		return nil, fmt.Errorf("device [%s] was not found", name)
 	}
 
-	var actions *[]Action
-	switch direction {
-	case "left":
-		actions = &ourDevice.Directions.Left
-	case "right":
-		actions = &ourDevice.Directions.Right
-	case "top":
-		actions = &ourDevice.Directions.Top
-	case "bottom":
-		actions = &ourDevice.Directions.Bottom
+	if position != NoPosition {
+		for i, segment := range ourDevice.Directions.Segments {
+			if segment.Edge == direction && segment.contains(position) {
+				return &ourDevice.Directions.Segments[i].Actions, nil
+			}
+		}
 	}
 
+	actions := ourDevice.Directions.actionsFor(direction)
 	if actions == nil {
 		return nil, nil
 	}
@@ -112,26 +221,114 @@ func (l *Layout) FindActions(name string, direction string) (*[]Action, error) {
 		return actions, nil
 	}
 
+	// A corner that has no actions of its own is still on the edges beside it, so the edge the mouse crossed is used
+	// instead. Clients that don't say which edge was crossed get the edges beside the corner, at the end it is on.
+	if contains(cornerEdges[direction], edge) {
+		return l.FindActionsAt(name, edge, "", position)
+	}
+	for _, edge := range cornerEdges[direction] {
+		if edgeActions, _ := l.FindActionsAt(name, edge, "", cornerPosition(direction, edge)); edgeActions != nil {
+			return edgeActions, nil
+		}
+	}
+
 	return nil, nil
 }
 
-// Effect tells the drivers to perform the actions for a given device in the matrix.
-func (l *Layout) Effect (actions *[]Action) {
-	if actions == nil || len(*actions) < 1 {
-		return
+// cornerEdges are the edges beside each corner, with the left or right edge first.
+var cornerEdges = map[string][]string{
+	"top_left":     {"left", "top"},
+	"top_right":    {"right", "top"},
+	"bottom_left":  {"left", "bottom"},
+	"bottom_right": {"right", "bottom"},
+}
+
+// cornerPosition is where a corner is along one of the edges beside it (0.0 or 1.0), so segments at that end are used.
+func cornerPosition(corner string, edge string) float64 {
+	if edge == "left" || edge == "right" {
+		if strings.HasPrefix(corner, "bottom") {
+			return 1
+		}
+		return 0
 	}
-	for _, item := range *actions {
-		driver := findDriver(item.DriverName)
-		action := item.PerformAction
-
-		switch d := driver.(type) {
-		case drivers.OutputSingle:
-			d.SetOutput(action)
-		case drivers.OutputMatrix:
-			if strings.Contains(action, "-") {
-				inOut := strings.Split(action, "-")
-				d.SetOutput(inOut[0], inOut[1])
-			}
+	if strings.HasSuffix(corner, "right") {
+		return 1
+	}
+	return 0
+}
+
+// edgeNames are the edges of a screen.
+var edgeNames = []string{"left", "right", "top", "bottom"}
+
+// cornerNames are the corners of a screen.
+var cornerNames = []string{"top_left", "top_right", "bottom_left", "bottom_right"}
+
+// directionNames are the directions that a computer can be left from, in the order they are checked.
+var directionNames = append(append([]string(nil), edgeNames...), cornerNames...)
+
+// isEdge checks if a direction is one of the edges of a screen (and not a corner).
+func isEdge(direction string) bool {
+	for _, edge := range edgeNames {
+		if edge == direction {
+			return true
 		}
 	}
-}
\ No newline at end of file
+	return false
+}
+
+// actionsFor returns the actions for a direction (or nil if there is no such direction).
+func (d *Directions) actionsFor(direction string) *[]Action {
+	switch direction {
+	case "left":
+		return &d.Left
+	case "right":
+		return &d.Right
+	case "top":
+		return &d.Top
+	case "bottom":
+		return &d.Bottom
+	case "top_left":
+		return &d.TopLeft
+	case "top_right":
+		return &d.TopRight
+	case "bottom_left":
+		return &d.BottomLeft
+	case "bottom_right":
+		return &d.BottomRight
+	}
+	return nil
+}
+
+// actionList is a list of actions belonging to a computer, along with where it came from.
+type actionList struct {
+	// name describes the list to a person (eg, "left", "activate").
+	name string
+	// path is where the list is found in the configuration, starting from the computer.
+	path []interface{}
+	actions []Action
+}
+
+// actionLists returns every list of actions for this computer.
+func (c *Computer) actionLists() []actionList {
+	var lists []actionList
+	for _, direction := range directionNames {
+		lists = append(lists, actionList{
+			name: direction,
+			path: []interface{}{"directions", direction},
+			actions: *c.Directions.actionsFor(direction),
+		})
+	}
+	for i, segment := range c.Directions.Segments {
+		lists = append(lists, actionList{
+			name: fmt.Sprintf("%s (%.2f-%.2f)", segment.Edge, segment.From, segment.To),
+			path: []interface{}{"directions", "segments", i, "actions"},
+			actions: segment.Actions,
+		})
+	}
+	lists = append(lists, actionList{
+		name: "activate",
+		path: []interface{}{"activate"},
+		actions: c.Activate,
+	})
+	return lists
+}
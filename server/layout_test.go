@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"github.com/timgws/kvm-switch/server/drivers"
 	"github.com/timgws/kvm-switch/server/drivers/blustream"
 	"github.com/timgws/kvm-switch/server/drivers/startech_kvm"
 	"log"
@@ -22,8 +23,8 @@ func TestLayoutDirection(t *testing.T) {
 }
 
 func TestLayoutWithDriver(t *testing.T) {
-	Drivers.Drivers = append(Drivers.Drivers, blustream.NewInstance())
-	Drivers.Drivers = append(Drivers.Drivers, startech_kvm.NewInstance())
+	Drivers.Drivers = append(Drivers.Drivers, blustream.NewInstance(drivers.Config{}))
+	Drivers.Drivers = append(Drivers.Drivers, startech_kvm.NewInstance(drivers.Config{}))
 
 	layout := BuildLayout()
 
@@ -36,4 +37,100 @@ func TestLayoutWithDriver(t *testing.T) {
 	log.Printf("%s %s", k, err)
 
 	//layout.Effect(actions)
-}
\ No newline at end of file
+}
+
+func TestLayoutEdgeSegments(t *testing.T) {
+	config, err := parseConfig([]byte(`layout:
+  computers:
+    - name: portrait
+      directions:
+        right: [{driver: kvm, action: "1"}]
+        segments:
+          - edge: right
+            from: 0
+            to: 0.5
+            actions: [{driver: kvm, action: "2"}]
+          - edge: right
+            from: 0.5
+            to: 1
+            actions: [{driver: kvm, action: "3"}]
+`))
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	tests := []struct {
+		position float64
+		expected string
+	}{
+		{0.1, "2"},
+		{0.75, "3"},
+		{NoPosition, "1"},
+	}
+	for _, test := range tests {
+		actions, _ := config.Layout.FindActionsAt("portrait", "right", "", test.position)
+		if actions == nil || (*actions)[0].PerformAction != test.expected {
+			t.Errorf("Expected action %s at position %.2f, got %v", test.expected, test.position, actions)
+		}
+	}
+}
+
+func TestLayoutCorners(t *testing.T) {
+	config, err := parseConfig([]byte(`layout:
+  computers:
+    - name: pc1
+      directions:
+        top: [{driver: kvm, action: "1"}]
+        top_left: [{driver: kvm, action: "4"}]
+        right: [{driver: kvm, action: "2"}]
+        segments:
+          - {edge: right, from: 0.5, to: 1, actions: [{driver: kvm, action: "3"}]}
+`))
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	tests := []struct {
+		corner   string
+		edge     string
+		position float64
+		action   string
+	}{
+		{"top_left", "top", 0, "4"},
+		// Corners without actions use the edge that the mouse crossed.
+		{"top_right", "top", 1, "1"},
+		{"top_right", "right", 0, "2"},
+		{"bottom_right", "right", 1, "3"},
+		{"bottom_left", "bottom", 0, ""},
+		// Clients that don't say which edge was crossed get the edges beside the corner (left or right first), at the
+		// end the corner is on.
+		{"top_right", "", NoPosition, "2"},
+		{"bottom_right", "", NoPosition, "3"},
+		{"bottom_left", "", NoPosition, ""},
+	}
+	for _, test := range tests {
+		actions, _ := config.Layout.FindActionsAt("pc1", test.corner, test.edge, test.position)
+		switch {
+		case test.action == "" && actions != nil:
+			t.Errorf("Expected nothing in the %s corner (crossing %q), got %v", test.corner, test.edge, *actions)
+		case test.action != "" && (actions == nil || (*actions)[0].PerformAction != test.action):
+			t.Errorf("Expected the %s corner (crossing %q) to switch to %s, got %v", test.corner, test.edge, test.action, actions)
+		}
+	}
+}
+
+func TestLayoutActivate(t *testing.T) {
+	layout := BuildLayout()
+
+	actions, err := layout.ActivateActions("streaming-computer")
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if (*actions)[0].Scene != "streaming" {
+		t.Errorf("Expected the streaming scene, got %v", *actions)
+	}
+
+	if _, err := layout.ActivateActions("nope"); err == nil {
+		t.Errorf("Expected an error for a computer that does not exist")
+	}
+}
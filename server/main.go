@@ -6,10 +6,13 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/timgws/kvm-switch/server/drivers"
-	"github.com/timgws/kvm-switch/server/drivers/blustream"
-	"github.com/timgws/kvm-switch/server/drivers/startech_kvm"
+	_ "github.com/timgws/kvm-switch/server/drivers/blustream"
+	_ "github.com/timgws/kvm-switch/server/drivers/startech_kvm"
 )
 
 const (
@@ -24,30 +27,81 @@ var serverContextCtx context.Context
 var serverContextCancel context.Context
 
 var addr = flag.String("addr", ":8787", "http service address")
+var configFile = flag.String("config", "", "YAML or JSON file describing the drivers and layout (the built-in config is used if empty)")
 
 type allDrivers struct {
 	Drivers []drivers.DriverInterface
+
+	// configs holds the configuration each driver was created with, keyed by the driver's short name.
+	configs map[string]drivers.Config
 }
 var Drivers allDrivers
-var TheLayout *Layout
-var JSONLayout []byte
 
+// driversLock guards Drivers, which can be replaced when the configuration is reloaded.
+var driversLock sync.RWMutex
 
-func main() {
-	generateLayout()
-	registerDrivers()
-	startDrivers()
+// LoadedLayout is the layout that is in use, along with the JSON that is served to clients.
+type LoadedLayout struct {
+	Layout *Layout
+	JSON   []byte
+}
+
+// loadedLayout holds the current *LoadedLayout, so that it can be swapped while clients are connected.
+var loadedLayout atomic.Value
+
+// TheLayout returns the layout that is currently in use.
+func TheLayout() *Layout {
+	return loadedLayout.Load().(*LoadedLayout).Layout
+}
+
+// JSONLayout returns the JSON representation of the layout that is currently in use.
+func JSONLayout() []byte {
+	return loadedLayout.Load().(*LoadedLayout).JSON
+}
 
+
+func main() {
 	flag.Parse()
+	if flag.Arg(0) == "import-barrier" {
+		os.Exit(importBarrierCommand(flag.Arg(1)))
+	}
+
+	config := readConfig()
+	generateLayout(config)
+	registerDrivers(config)
+	if err := checkLayout(TheLayout(), registeredDrivers()); err != nil {
+		log.Fatalf("The layout can not be used:\n%s", err)
+	}
+	if flag.Arg(0) == "check" {
+		os.Exit(checkCommand(TheLayout(), registeredDrivers()))
+	}
+	if flag.Arg(0) == "export-barrier" {
+		if err := exportBarrier(TheLayout(), registeredDrivers(), os.Stdout); err != nil {
+			log.Fatalf("Could not export the layout: %s", err)
+		}
+		os.Exit(0)
+	}
+	drivers.OnEvent(goHomeOnConnect)
+	startDrivers(registeredDrivers())
+	go goHome(TheLayout(), registeredDrivers())
+	watchConfig()
 
 	hub := newHub()
 	go hub.run()
+	drivers.OnEvent(hub.announceDriverEvent)
 
 	http.HandleFunc("/", serveHome)
 	http.HandleFunc("/layout", serveLayout)
+	http.HandleFunc("/layout/validate", serveLayoutValidate)
+	http.HandleFunc("/layout/check", serveLayoutCheck)
 	http.HandleFunc("/driverStatus", serveDriverStatus)
 	http.HandleFunc("/refreshStatus", serveRefreshStatus)
-	http.HandleFunc("/swap/:driver/:input/:output", serveSwap)
+	http.HandleFunc("/configStatus", serveConfigStatus)
+	http.HandleFunc("/scenes/", serveScene)
+	http.HandleFunc("/computers/", serveActivate)
+	http.HandleFunc("/swap/", serveSwapRoute)
+	http.HandleFunc("/undo", serveUndo)
+	http.HandleFunc("/history", serveHistory)
 	http.HandleFunc("/swap", serveSwap)
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		serveWs(hub, w, r)
@@ -59,41 +113,78 @@ func main() {
 	}
 }
 
-// generateLayout should generate a layout from configuration.
-// TODO: fix the should.
-func generateLayout() {
-	TheLayout = BuildLayout()
+// readConfig loads the configuration file (or the built-in config when there is no file).
+func readConfig() *Config {
+	if *configFile == "" {
+		return builtInConfig()
+	}
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Could not load the configuration from %s:\n%s", *configFile, err)
+	}
+	setConfigStatus(nil)
+	return config
+}
+
+// generateLayout sets the layout that will be used from the configuration.
+func generateLayout(config *Config) {
+	layout := &config.Layout
+	jsonLayout, _ := json.Marshal(layout)
+	loadedLayout.Store(&LoadedLayout{
+		Layout: layout,
+		JSON:   jsonLayout,
+	})
+
 	if (EnableDebugMode) {
-		JSONLayout, _ = json.Marshal(TheLayout)
-		log.Printf("Layout JSON: %s", string(JSONLayout))
+		log.Printf("Layout JSON: %s", string(jsonLayout))
 	}
 }
 
-// registerDrivers should go through config, and init the correct drivers required for the layout.
-// TODO: fix the 'should'
-func registerDrivers() {
-	stkvm := startech_kvm.NewInstance()
-	Drivers.Drivers = append(Drivers.Drivers, stkvm)
-	bsmatrix := blustream.NewInstance()
-	Drivers.Drivers = append(Drivers.Drivers, bsmatrix)
+// registerDrivers creates an instance of every driver in the configuration.
+func registerDrivers(config *Config) {
+	driversLock.Lock()
+	defer driversLock.Unlock()
+
+	Drivers.configs = map[string]drivers.Config{}
+	for _, driverConfig := range config.Drivers {
+		driver, err := drivers.New(driverConfig)
+		if err != nil {
+			log.Fatalf("Could not create driver [%s]: %s", driverConfig.ShortName, err)
+		}
+		Drivers.Drivers = append(Drivers.Drivers, driver)
+		Drivers.configs[driverConfig.ShortName] = driverConfig
+	}
 }
 
-// startDrivers will start all registered drivers.
-func startDrivers() {
-	for _, driver := range Drivers.Drivers {
+// registeredDrivers returns all of the drivers that are currently registered.
+func registeredDrivers() []drivers.DriverInterface {
+	driversLock.RLock()
+	defer driversLock.RUnlock()
+
+	return append([]drivers.DriverInterface(nil), Drivers.Drivers...)
+}
+
+// startDrivers will start the given drivers.
+func startDrivers(driversToStart []drivers.DriverInterface) {
+	for _, driver := range driversToStart {
 		starting := driver.Start()
 		if EnableDebugMode {
-			log.Printf("Started driver: %s (did it attempt to start? %b)", driver.DriverName(), starting)
+			log.Printf("Started driver: %s (did it attempt to start? %t)", driver.DriverName(), starting)
 		}
 		if driver.LastError() != nil {
-			log.Printf("[%s]: ERROR: %e", driver.DriverName(), driver.LastError())
+			connection := ""
+			if configured, ok := driver.(drivers.Configured); ok {
+				connection = " (" + configured.Config().Connection() + ")"
+			}
+			log.Printf("[%s]: ERROR%s: %s", driver.DriverName(), connection, driver.LastError())
 		}
 	}
 }
 
 // findDriver will return an instance of a driver with the given shortName that the driver was configured with.
 func findDriver(shortName string) drivers.DriverInterface {
-	for _, driver := range Drivers.Drivers {
+	for _, driver := range registeredDrivers() {
 		if driver.GetShortName() == shortName {
 			return driver
 		}
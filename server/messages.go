@@ -16,8 +16,31 @@ type IncomingAction struct {
 	ActionDirection Direction `json:"optional"`
 }
 
+// ActivateComputer is sent by a client to make a computer the active machine, without moving the mouse.
+// { "activate": "streaming-computer" }
+type ActivateComputer struct {
+	Computer string `json:"activate" kvm:"required"`
+}
+
+// Unmarshal reads an ActivateComputer message, checking that the computer has been given.
+func (ac *ActivateComputer) Unmarshal(data []byte) error {
+	return unmarshalMessage(data, ac)
+}
+
+// UndoRouting is sent by a client to put the drivers back to how they were before the last switch.
+// { "undo": true }
+type UndoRouting struct {
+	Undo bool `json:"undo" kvm:"required"`
+}
+
+// Unmarshal reads an UndoRouting message.
+func (u *UndoRouting) Unmarshal(data []byte) error {
+	return unmarshalMessage(data, u)
+}
+
 // BroadcastAction is what will be sent to all connected clients when an operation has been performed by the server
 // { "action_name": "active_computer", "value": "pc1" }
 type BroadcastAction struct {
-	ActionName string
+	ActionName string      `json:"action_name"`
+	Value      interface{} `json:"value,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// configPollInterval is how often the configuration file is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// ConfigStatus describes the configuration file that the server is running with, and how the last reload went.
+type ConfigStatus struct {
+	ConfigFile  string    `json:"config_file"`
+	LoadedAt    time.Time `json:"loaded_at"`
+	LastAttempt time.Time `json:"last_attempt"`
+
+	// Error is set when the last attempt to reload failed. The server keeps running with the previous config.
+	Error string `json:"error,omitempty"`
+}
+
+var configStatus ConfigStatus
+var configStatusLock sync.Mutex
+
+// reloadLock makes sure that only one reload happens at a time.
+var reloadLock sync.Mutex
+
+// setConfigStatus records the outcome of loading the configuration file.
+func setConfigStatus(err error) {
+	configStatusLock.Lock()
+	defer configStatusLock.Unlock()
+
+	now := time.Now()
+	configStatus.ConfigFile = *configFile
+	configStatus.LastAttempt = now
+	if err != nil {
+		configStatus.Error = err.Error()
+		return
+	}
+	configStatus.LoadedAt = now
+	configStatus.Error = ""
+}
+
+// currentConfigStatus returns a copy of the status of the configuration file.
+func currentConfigStatus() ConfigStatus {
+	configStatusLock.Lock()
+	defer configStatusLock.Unlock()
+	return configStatus
+}
+
+// watchConfig reloads the configuration when the server receives SIGHUP, or the configuration file changes.
+func watchConfig() {
+	if *configFile == "" {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	lastModified := modifiedTime(*configFile)
+	ticker := time.NewTicker(configPollInterval)
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				log.Printf("[config]: Received SIGHUP, reloading %s", *configFile)
+			case <-ticker.C:
+				modified := modifiedTime(*configFile)
+				if modified.Equal(lastModified) {
+					continue
+				}
+				lastModified = modified
+				log.Printf("[config]: %s has changed, reloading", *configFile)
+			}
+
+			if err := reloadConfig(); err != nil {
+				log.Printf("[config]: Keeping the current configuration, the new one has errors:\n%s", err)
+			}
+		}
+	}()
+}
+
+// modifiedTime returns when a file was last changed (or the zero time if it can't be read).
+func modifiedTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig reads the configuration file again, and replaces the drivers & layout that are running.
+// If the new configuration can't be used, the current one is left in place.
+func reloadConfig() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	config, err := loadConfig(*configFile)
+	if err == nil {
+		err = reloadDrivers(config)
+	}
+	setConfigStatus(err)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[config]: Loaded %s", *configFile)
+	return nil
+}
+
+// reloadDrivers replaces the running drivers & the layout with the ones in config.
+// Drivers whose configuration has not changed are kept running (along with their open serial ports).
+// Drivers that have changed are shut down, and started again with their new configuration.
+func reloadDrivers(config *Config) error {
+	driversLock.RLock()
+	running := map[string]drivers.DriverInterface{}
+	for _, driver := range Drivers.Drivers {
+		running[driver.GetShortName()] = driver
+	}
+	oldConfigs := Drivers.configs
+	driversLock.RUnlock()
+
+	// Create all of the new drivers before touching the running ones, so a bad driver leaves everything as-is.
+	var newDrivers, toStart []drivers.DriverInterface
+	newConfigs := map[string]drivers.Config{}
+	for _, driverConfig := range config.Drivers {
+		newConfigs[driverConfig.ShortName] = driverConfig
+
+		if driver, exists := running[driverConfig.ShortName]; exists && reflect.DeepEqual(oldConfigs[driverConfig.ShortName], driverConfig) {
+			newDrivers = append(newDrivers, driver)
+			delete(running, driverConfig.ShortName)
+			continue
+		}
+
+		driver, err := drivers.New(driverConfig)
+		if err != nil {
+			return err
+		}
+		newDrivers = append(newDrivers, driver)
+		toStart = append(toStart, driver)
+	}
+
+	if err := checkLayout(&config.Layout, newDrivers); err != nil {
+		return err
+	}
+
+	// Nothing can be switched while the drivers are swapped, so actions never use a driver that is being shut down,
+	// or the new drivers with the old layout.
+	effectLock.Lock()
+	defer effectLock.Unlock()
+
+	// Anything left over has either changed, or been removed from the configuration.
+	for shortName, driver := range running {
+		log.Printf("[config]: Shutting down driver [%s]", shortName)
+		driver.Shutdown()
+	}
+
+	driversLock.Lock()
+	Drivers.Drivers = newDrivers
+	Drivers.configs = newConfigs
+	driversLock.Unlock()
+	generateLayout(config)
+
+	startDrivers(toStart)
+	go goHome(&config.Layout, toStart)
+	return nil
+}
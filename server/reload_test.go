@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// fakeDriver is a driver that doesn't talk to anything, so that tests can see what the server does with drivers.
+type fakeDriver struct {
+	config   drivers.Config
+	running  bool
+	starts   int
+	shutdown int
+}
+
+func (f *fakeDriver) DriverName() string      { return "Fake" }
+func (f *fakeDriver) GetShortName() string    { return f.config.ShortName }
+func (f *fakeDriver) IsRunning() bool         { return f.running }
+func (f *fakeDriver) SupportsInitState() bool { return true }
+func (f *fakeDriver) Start() bool             { f.starts++; f.running = true; return true }
+func (f *fakeDriver) Shutdown() bool          { f.shutdown++; f.running = false; return true }
+func (f *fakeDriver) GetStatus()              {}
+func (f *fakeDriver) LastError() error        { return nil }
+func (f *fakeDriver) IsMatrix() bool          { return false }
+
+func init() {
+	drivers.Register("fake", func(config drivers.Config) (drivers.DriverInterface, error) {
+		return &fakeDriver{config: config}, nil
+	})
+}
+
+func writeTestConfig(t *testing.T, path string, config string) {
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Could not write config: %s", err)
+	}
+}
+
+func TestReloadKeepsUnchangedDrivers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fence.yaml")
+	*configFile = path
+	defer func() { *configFile = "" }()
+
+	writeTestConfig(t, path, `drivers:
+  - {type: fake, name: kvm, serial_device: /dev/kvm}
+  - {type: fake, name: matrix, serial_device: /dev/matrix}
+layout:
+  computers:
+    - name: pc1
+`)
+	config := readConfig()
+	generateLayout(config)
+	Drivers = allDrivers{}
+	registerDrivers(config)
+	startDrivers(registeredDrivers())
+
+	kvm := findDriver("kvm").(*fakeDriver)
+	matrix := findDriver("matrix").(*fakeDriver)
+
+	writeTestConfig(t, path, `drivers:
+  - {type: fake, name: kvm, serial_device: /dev/kvm}
+  - {type: fake, name: matrix, serial_device: /dev/other-matrix}
+layout:
+  computers:
+    - name: pc2
+`)
+	if err := reloadConfig(); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	if findDriver("kvm") != kvm || kvm.shutdown != 0 || kvm.starts != 1 {
+		t.Errorf("The kvm driver did not change, it should have been left running")
+	}
+	if findDriver("matrix") == matrix || matrix.shutdown != 1 || !findDriver("matrix").IsRunning() {
+		t.Errorf("The matrix driver changed, it should have been shut down and replaced")
+	}
+	if TheLayout().Computers[0].Name != "pc2" {
+		t.Errorf("The layout was not replaced")
+	}
+
+	writeTestConfig(t, path, `layout:
+  computers:
+    - name: pc3
+      colour: blue
+`)
+	if err := reloadConfig(); err == nil {
+		t.Fatalf("Expected the bad config to be rejected")
+	}
+	if TheLayout().Computers[0].Name != "pc2" || len(registeredDrivers()) != 2 {
+		t.Errorf("A bad config should leave the running config in place")
+	}
+	if currentConfigStatus().Error == "" {
+		t.Errorf("The config status should report the error")
+	}
+}
+
+func TestReloadWaitsForActionsToFinish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fence.yaml")
+	*configFile = path
+	defer func() { *configFile = "" }()
+
+	writeTestConfig(t, path, `drivers:
+  - {type: fake, name: kvm, serial_device: /dev/kvm}
+layout:
+  computers:
+    - name: pc1
+`)
+	config := readConfig()
+	generateLayout(config)
+	Drivers = allDrivers{}
+	registerDrivers(config)
+	startDrivers(registeredDrivers())
+
+	writeTestConfig(t, path, `drivers:
+  - {type: fake, name: kvm, serial_device: /dev/other-kvm}
+layout:
+  computers:
+    - name: pc2
+`)
+
+	// Pretend that some actions are being performed.
+	effectLock.Lock()
+	reloaded := make(chan error)
+	go func() { reloaded <- reloadConfig() }()
+
+	select {
+	case <-reloaded:
+		t.Fatal("The config was reloaded while actions were being performed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if TheLayout().Computers[0].Name != "pc1" {
+		t.Errorf("The layout was replaced while actions were being performed")
+	}
+
+	effectLock.Unlock()
+	if err := <-reloaded; err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if TheLayout().Computers[0].Name != "pc2" {
+		t.Errorf("The layout was not replaced")
+	}
+}
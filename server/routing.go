@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// RoutingState is the input that each output of each driver is showing.
+// Drivers with a single output (eg, a KVM) use "" as the name of their output.
+type RoutingState map[string]map[string]string
+
+// set records that an output of a driver is showing an input.
+func (r RoutingState) set(driverName, outputName, inputName string) {
+	if r[driverName] == nil {
+		r[driverName] = map[string]string{}
+	}
+	r[driverName][outputName] = inputName
+}
+
+// get returns the input that an output of a driver was showing, if it was known.
+func (r RoutingState) get(driverName, outputName string) (string, bool) {
+	input, known := r[driverName][outputName]
+	return input, known
+}
+
+// AllOutputs can be used as the output of an action, to switch every output of a matrix to the same input.
+const AllOutputs = "all"
+
+// layerNames are the layers that an action can switch on its own (if the driver supports it).
+var layerNames = []string{"video", "audio", "usb"}
+
+// Route is a single output of a driver being switched to an input.
+// Output is "" for drivers with a single output, and Layer is "" to switch everything that the driver switches.
+type Route struct {
+	Output string
+	Input  string
+	Layer  string
+}
+
+func (r Route) String() string {
+	description := fmt.Sprintf("swap output %s to input %s", r.Output, r.Input)
+	if r.Output == "" {
+		description = fmt.Sprintf("select input %s", r.Input)
+	}
+	if r.Layer != "" {
+		description += fmt.Sprintf(" (%s)", r.Layer)
+	}
+	return description
+}
+
+// routes works out the outputs that an action switches, and the input they are switched to.
+// Actions can be written with input & output (or outputs), or with the older action string: <output>-<input> for a
+// matrix (eg, "01-03" shows input 03 on output 01), or just the input for drivers with a single output.
+// The names of ports can be aliases, which are turned into the name of the port.
+func (a Action) routes(driver drivers.DriverInterface) ([]Route, error) {
+	_, isMatrix := driver.(drivers.OutputMatrix)
+	aliases := drivers.AliasesOf(driver)
+
+	if a.PerformAction != "" {
+		if !isMatrix {
+			if strings.Contains(a.PerformAction, "-") && !aliases.IsAlias(a.PerformAction) {
+				return nil, fmt.Errorf("[%s] only has one output, expected an input but got [%s]", a.DriverName, a.PerformAction)
+			}
+			return []Route{{Input: aliases.InputPort(a.PerformAction)}}, nil
+		}
+
+		output, input, ok := splitMatrixAction(a.PerformAction, aliases)
+		if !ok {
+			return nil, fmt.Errorf("[%s] is a matrix, expected <output>-<input> but got [%s]", a.DriverName, a.PerformAction)
+		}
+		return []Route{{Output: aliases.OutputPort(output), Input: aliases.InputPort(input)}}, nil
+	}
+
+	if a.Input == "" {
+		return nil, fmt.Errorf("an input is required for [%s]", a.DriverName)
+	}
+
+	outputs := a.Outputs
+	if a.Output != "" {
+		outputs = append([]string{a.Output}, outputs...)
+	}
+	if !isMatrix {
+		if len(outputs) > 0 {
+			return nil, fmt.Errorf("[%s] only has one output, remove output(s) from the action", a.DriverName)
+		}
+		return []Route{{Input: aliases.InputPort(a.Input), Layer: a.Layer}}, nil
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("[%s] is a matrix, an output (or outputs) is required", a.DriverName)
+	}
+
+	var routes []Route
+	seen := map[string]bool{}
+	for _, output := range outputs {
+		names := []string{aliases.OutputPort(output)}
+		if output == AllOutputs {
+			ports, ok := driver.(drivers.PortLister)
+			if !ok {
+				return nil, fmt.Errorf("[%s] can not list its outputs, so %q can not be used", a.DriverName, AllOutputs)
+			}
+			names = ports.OutputNames()
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				routes = append(routes, Route{Output: name, Input: aliases.InputPort(a.Input), Layer: a.Layer})
+			}
+		}
+	}
+	return routes, nil
+}
+
+// splitMatrixAction splits a <output>-<input> action. As aliases can have a dash in them (eg, left-monitor-ps5),
+// each side needs to either be an alias, or not have a dash.
+func splitMatrixAction(action string, aliases drivers.Aliases) (output string, input string, ok bool) {
+	parts := strings.Split(action, "-")
+	for i := 1; i < len(parts); i++ {
+		output = strings.Join(parts[:i], "-")
+		input = strings.Join(parts[i:], "-")
+		if output == "" || input == "" {
+			continue
+		}
+		if (i == 1 || aliases.OutputPort(output) != output) && (i == len(parts)-1 || aliases.InputPort(input) != input) {
+			return output, input, true
+		}
+	}
+	return "", "", false
+}
+
+// setRoute tells a driver to switch an output to an input.
+func setRoute(driver drivers.DriverInterface, route Route) error {
+	if route.Layer != "" {
+		layered, ok := driver.(drivers.LayeredOutput)
+		if !ok || !contains(layered.Layers(), route.Layer) {
+			return fmt.Errorf("the %s layer can not be switched on its own", route.Layer)
+		}
+		return layered.SetLayerOutput(route.Layer, route.Output, route.Input)
+	}
+
+	switch d := driver.(type) {
+	case drivers.OutputSingle:
+		return d.SetOutput(route.Input)
+	case drivers.OutputMatrix:
+		return d.SetOutput(route.Output, route.Input)
+	}
+	return errors.New("the driver can not switch inputs or outputs")
+}
+
+// currentRoute asks a driver which input an output is showing, if the driver knows.
+func currentRoute(driver drivers.DriverInterface, outputName string) (string, bool) {
+	switch state := driver.(type) {
+	case drivers.MatrixState:
+		return state.CurrentInput(outputName)
+	case drivers.SingleState:
+		return state.CurrentInput()
+	}
+	return "", false
+}
+
+// record remembers what the outputs that actions are going to change are currently showing.
+// Outputs that have already been recorded are left alone, so the snapshot keeps what they were showing first.
+// Outputs that the driver can't tell us about are left out.
+func (r RoutingState) record(actions []Action) {
+	for _, action := range actions {
+		driver := findDriver(action.DriverName)
+		if driver == nil {
+			continue
+		}
+		routes, err := action.routes(driver)
+		if err != nil {
+			continue
+		}
+		for _, route := range routes {
+			// Drivers only tell us about what is being shown, not about each layer.
+			if route.Layer != "" {
+				continue
+			}
+			if _, seen := r.get(action.DriverName, route.Output); seen {
+				continue
+			}
+			if input, known := currentRoute(driver, route.Output); known {
+				r.set(action.DriverName, route.Output, input)
+			}
+		}
+	}
+}
+
+// currentRoutes asks every driver what its outputs are showing. Anything a driver doesn't know is left out.
+func currentRoutes() RoutingState {
+	state := RoutingState{}
+	for _, driver := range registeredDrivers() {
+		outputs := []string{""}
+		if _, isMatrix := driver.(drivers.OutputMatrix); isMatrix {
+			ports, ok := driver.(drivers.PortLister)
+			if !ok {
+				continue
+			}
+			outputs = ports.OutputNames()
+		}
+
+		for _, output := range outputs {
+			if input, known := currentRoute(driver, output); known {
+				state.set(driver.GetShortName(), output, input)
+			}
+		}
+	}
+	return state
+}
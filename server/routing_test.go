@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// listedMatrix is a matrix that can list its ports.
+type listedMatrix struct {
+	*fakeMatrix
+}
+
+func (l listedMatrix) InputNames() []string  { return []string{"01", "02", "03", "04"} }
+func (l listedMatrix) OutputNames() []string { return []string{"01", "02", "03"} }
+
+func TestActionRoutes(t *testing.T) {
+	matrix := listedMatrix{&fakeMatrix{routes: map[string]string{}}}
+	kvm := &fakeKvm{}
+
+	tests := []struct {
+		name   string
+		driver drivers.DriverInterface
+		action Action
+		routes []Route
+	}{{
+		name:   "legacy matrix action",
+		driver: matrix,
+		action: Action{PerformAction: "01-03"},
+		routes: []Route{{Output: "01", Input: "03"}},
+	}, {
+		name:   "legacy kvm action",
+		driver: kvm,
+		action: Action{PerformAction: "2"},
+		routes: []Route{{Input: "2"}},
+	}, {
+		name:   "output & outputs",
+		driver: matrix,
+		action: Action{Input: "04", Output: "02", Outputs: []string{"01", "02"}, Layer: "audio"},
+		routes: []Route{{Output: "02", Input: "04", Layer: "audio"}, {Output: "01", Input: "04", Layer: "audio"}},
+	}, {
+		name:   "all outputs",
+		driver: matrix,
+		action: Action{Input: "01", Output: AllOutputs},
+		routes: []Route{{Output: "01", Input: "01"}, {Output: "02", Input: "01"}, {Output: "03", Input: "01"}},
+	}, {
+		name:   "kvm input",
+		driver: kvm,
+		action: Action{Input: "3"},
+		routes: []Route{{Input: "3"}},
+	}}
+
+	for _, test := range tests {
+		routes, err := test.action.routes(test.driver)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+		if !reflect.DeepEqual(routes, test.routes) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.routes, routes)
+		}
+	}
+
+	for _, bad := range []Action{{PerformAction: "0103"}, {Input: "01"}, {PerformAction: "-03"}} {
+		if _, err := bad.routes(matrix); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+	if _, err := (Action{Input: "1", Output: "01"}).routes(kvm); err == nil {
+		t.Errorf("Expected an error when giving a KVM an output")
+	}
+}
+
+// aliasedMatrix is a matrix with aliases for some of its ports.
+type aliasedMatrix struct {
+	listedMatrix
+}
+
+func (a aliasedMatrix) Config() drivers.Config {
+	return drivers.Config{Aliases: drivers.Aliases{
+		Inputs:  map[string]string{"03": "ps5"},
+		Outputs: map[string]string{"02": "left-monitor"},
+	}}
+}
+
+func TestActionRoutesWithAliases(t *testing.T) {
+	matrix := aliasedMatrix{listedMatrix{&fakeMatrix{routes: map[string]string{}}}}
+
+	for _, action := range []Action{
+		{PerformAction: "left-monitor-ps5"},
+		{PerformAction: "02-ps5"},
+		{PerformAction: "left-monitor-03"},
+		{Input: "ps5", Output: "left-monitor"},
+		{Input: "03", Outputs: []string{"left-monitor"}},
+	} {
+		routes, err := action.routes(matrix)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", action, err)
+		}
+		if !reflect.DeepEqual(routes, []Route{{Output: "02", Input: "03"}}) {
+			t.Errorf("%v: expected output 02 to show input 03, got %v", action, routes)
+		}
+	}
+
+	if _, err := (Action{PerformAction: "left-monitor-xbox-one"}).routes(matrix); err == nil {
+		t.Errorf("Expected an error when an alias is not known")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSceneDepth stops a scene that refers to itself from expanding forever (these are caught when loading the config).
+const maxSceneDepth = 32
+
+// Scene is a named list of actions that can be defined once, and used from any direction (or another scene).
+type Scene struct {
+	Name    string   `json:"name" yaml:"name"`
+	Actions []Action `json:"actions" yaml:"actions"`
+
+	// When is checked before the scene is performed. If it is not met, the Else actions are performed instead.
+	When *Condition `json:"when,omitempty" yaml:"when,omitempty"`
+	Else []Action   `json:"else,omitempty" yaml:"else,omitempty"`
+}
+
+// findScene returns the scene with the given name, or nil if there is no such scene.
+func (l *Layout) findScene(name string) *Scene {
+	for i, scene := range l.Scenes {
+		if scene.Name == name {
+			return &l.Scenes[i]
+		}
+	}
+	return nil
+}
+
+// expandScenes replaces any action that refers to a scene with the actions from the scene, in order.
+// Conditions are not checked (Effect checks them as it gets to them), so the actions of a scene are always used.
+func (l *Layout) expandScenes(actions []Action) ([]Action, error) {
+	return l.expandScenesDepth(actions, 0)
+}
+
+func (l *Layout) expandScenesDepth(actions []Action, depth int) ([]Action, error) {
+	if depth > maxSceneDepth {
+		return nil, fmt.Errorf("scenes are nested more than %d deep", maxSceneDepth)
+	}
+
+	var expanded []Action
+	for _, action := range actions {
+		if action.Scene == "" {
+			expanded = append(expanded, action)
+			continue
+		}
+
+		scene := l.findScene(action.Scene)
+		if scene == nil {
+			return nil, fmt.Errorf("scene [%s] was not found", action.Scene)
+		}
+
+		sceneActions, err := l.expandScenesDepth(scene.Actions, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, sceneActions...)
+	}
+	return expanded, nil
+}
+
+// findSceneCycle looks for a scene that (eventually) refers back to itself.
+// The scenes that make up the loop are returned (eg, [a b a]), or nil if there are no loops.
+func (l *Layout) findSceneCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		scene := l.findScene(name)
+		if scene == nil || state[name] == visited {
+			return nil
+		}
+		if state[name] == visiting {
+			for i, step := range path {
+				if step == name {
+					return append(append([]string(nil), path[i:]...), name)
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, ref := range sceneRefs(append(append([]Action(nil), scene.Actions...), scene.Else...)) {
+			if cycle := visit(ref); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, scene := range l.Scenes {
+		if cycle := visit(scene.Name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// sceneRefs returns the scenes used by a list of actions (including the else actions of any conditions).
+func sceneRefs(actions []Action) []string {
+	var refs []string
+	for _, action := range actions {
+		if action.Scene != "" {
+			refs = append(refs, action.Scene)
+		}
+		refs = append(refs, sceneRefs(action.Else)...)
+	}
+	return refs
+}
+
+// formatSceneCycle describes a loop of scenes to a person (eg, a -> b -> a).
+func formatSceneCycle(cycle []string) string {
+	return strings.Join(cycle, " -> ")
+}
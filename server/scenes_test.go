@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScenesExpand(t *testing.T) {
+	layout := BuildLayout()
+	actions, _ := layout.FindActions("home-computer", "right")
+
+	expanded, err := layout.expandScenes(*actions)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	var performed []string
+	for _, action := range expanded {
+		performed = append(performed, action.DriverName+" "+action.PerformAction)
+	}
+	if strings.Join(performed, ", ") != "matrix 01-03, matrix 02-04, kvm 4" {
+		t.Errorf("The streaming scene was not expanded correctly, got: %s", strings.Join(performed, ", "))
+	}
+}
+
+func TestScenesCanNotReferToThemselves(t *testing.T) {
+	_, err := parseConfig([]byte(`layout:
+  computers:
+    - name: pc1
+      directions:
+        left: [{scene: a}]
+  scenes:
+    - name: a
+      actions: [{driver: kvm, action: "1"}, {scene: b}]
+    - name: b
+      actions: [{scene: c}]
+    - name: c
+      actions: [{scene: a}]
+`))
+	if err == nil {
+		t.Fatalf("Expected the config to be rejected")
+	}
+	if !strings.Contains(err.Error(), "line 7: layout.scenes[0]: scenes can not refer to themselves (a -> b -> c -> a)") {
+		t.Errorf("Expected the loop to be reported, got: %s", err)
+	}
+}
+
+func TestScenesMustExist(t *testing.T) {
+	_, err := parseConfig([]byte(`layout:
+  computers:
+    - name: pc1
+      directions:
+        left: [{scene: nope}]
+`))
+	if err == nil || !strings.Contains(err.Error(), "scene [nope] has not been defined") {
+		t.Errorf("Expected the unknown scene to be reported, got: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+)
+
+// Severity is how bad a problem found in a layout is.
+type Severity string
+
+const (
+	// SeverityError is a problem that will stop an action from working.
+	SeverityError Severity = "error"
+	// SeverityWarning is something that might not be what was intended, or could not be checked.
+	SeverityWarning Severity = "warning"
+)
+
+// ValidationIssue is a problem that was found with a single action (or computer) in a layout.
+// Action is the number of the action in its list (starting from 1), or 0 for a problem with the whole computer (or
+// scene).
+type ValidationIssue struct {
+	Severity  Severity `json:"severity"`
+	Computer  string   `json:"computer,omitempty"`
+	Scene     string   `json:"scene,omitempty"`
+	Direction string   `json:"direction,omitempty"`
+	Action    int      `json:"action,omitempty"`
+	Message   string   `json:"message"`
+}
+
+func (i ValidationIssue) String() string {
+	if i.Scene != "" {
+		switch i.Direction {
+		case "":
+			if i.Action == 0 {
+				return fmt.Sprintf("%s: scene [%s]: %s", i.Severity, i.Scene, i.Message)
+			}
+			return fmt.Sprintf("%s: scene [%s] action #%d: %s", i.Severity, i.Scene, i.Action, i.Message)
+		case "when":
+			return fmt.Sprintf("%s: scene [%s] when: %s", i.Severity, i.Scene, i.Message)
+		}
+		return fmt.Sprintf("%s: scene [%s] %s action #%d: %s", i.Severity, i.Scene, i.Direction, i.Action, i.Message)
+	}
+	if i.Direction == "" {
+		return fmt.Sprintf("%s: [%s]: %s", i.Severity, i.Computer, i.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s action #%d: %s", i.Severity, i.Computer, i.Direction, i.Action, i.Message)
+}
+
+// ValidationIssues are all of the problems that were found in a layout.
+type ValidationIssues []ValidationIssue
+
+// HasErrors will be true if any of the issues will stop an action from working.
+func (v ValidationIssues) HasErrors() bool {
+	for _, issue := range v {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns just the issues that will stop an action from working.
+func (v ValidationIssues) Errors() ValidationIssues {
+	var errs ValidationIssues
+	for _, issue := range v {
+		if issue.Severity == SeverityError {
+			errs = append(errs, issue)
+		}
+	}
+	return errs
+}
+
+func (v ValidationIssues) Error() string {
+	lines := make([]string, len(v))
+	for i, issue := range v {
+		lines[i] = issue.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkLayout validates a layout, logging any warnings.
+// If there is anything in the layout that will not work, the errors are returned.
+func checkLayout(layout *Layout, driverList []drivers.DriverInterface) error {
+	issues := layout.Validate(driverList)
+	for _, issue := range issues {
+		if issue.Severity == SeverityWarning {
+			log.Printf("[layout]: %s", issue)
+		}
+	}
+
+	if issues.HasErrors() {
+		return issues.Errors()
+	}
+	return nil
+}
+
+// Validate checks every action in the layout against the drivers that will perform them.
+func (l *Layout) Validate(driverList []drivers.DriverInterface) ValidationIssues {
+	issues := ValidationIssues{}
+
+	for _, computer := range l.Computers {
+		hasActions := false
+		for _, list := range computer.actionLists() {
+			if list.name != "activate" && len(list.actions) > 0 {
+				hasActions = true
+			}
+			issues = append(issues, validateActions(list.actions, driverList, ValidationIssue{
+				Computer:  computer.Name,
+				Direction: list.name,
+			})...)
+		}
+
+		issues = append(issues, overlappingSegments(computer)...)
+
+		if !hasActions {
+			issues = append(issues, ValidationIssue{
+				Severity: SeverityWarning,
+				Computer: computer.Name,
+				Message:  "there are no actions, moving the mouse off this screen will not do anything",
+			})
+		}
+	}
+
+	for _, scene := range l.Scenes {
+		if len(scene.Actions) == 0 {
+			issues = append(issues, ValidationIssue{
+				Severity: SeverityWarning,
+				Scene:    scene.Name,
+				Message:  "there are no actions, performing this scene will not do anything",
+			})
+		}
+		issues = append(issues, validateActions(scene.Actions, driverList, ValidationIssue{Scene: scene.Name})...)
+		if scene.When == nil {
+			continue
+		}
+		if severity, message := validateCondition(scene.When, driverList); message != "" {
+			issues = append(issues, ValidationIssue{Severity: severity, Scene: scene.Name, Direction: "when", Message: message})
+		}
+		issues = append(issues, validateActions(scene.Else, driverList, ValidationIssue{Scene: scene.Name, Direction: "else"})...)
+	}
+
+	return issues
+}
+
+// overlappingSegments finds segments that share part of the same edge. Only the first of them is used where they
+// overlap, which is not what was meant. Segments can touch (eg, 0-0.5 & 0.5-1).
+func overlappingSegments(computer Computer) ValidationIssues {
+	var issues ValidationIssues
+	segments := computer.Directions.Segments
+	for i, a := range segments {
+		for _, b := range segments[i+1:] {
+			if a.Edge == b.Edge && a.From < b.To && b.From < a.To {
+				issues = append(issues, ValidationIssue{
+					Severity: SeverityError,
+					Computer: computer.Name,
+					Message:  fmt.Sprintf("the %s segments %.2f-%.2f and %.2f-%.2f overlap", a.Edge, a.From, a.To, b.From, b.To),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// validateActions checks a list of actions (and the else actions of any conditions).
+// Issues are reported against where the list came from in base.
+func validateActions(actions []Action, driverList []drivers.DriverInterface, base ValidationIssue) ValidationIssues {
+	var issues ValidationIssues
+	report := func(i int, severity Severity, message string) {
+		issue := base
+		issue.Severity = severity
+		issue.Action = i + 1
+		issue.Message = message
+		issues = append(issues, issue)
+	}
+
+	for i, action := range actions {
+		if severity, message := validateAction(action, driverList); message != "" {
+			report(i, severity, message)
+		}
+		if action.When == nil {
+			continue
+		}
+
+		if severity, message := validateCondition(action.When, driverList); message != "" {
+			report(i, severity, message)
+		}
+		elseList := base
+		elseList.Direction = strings.TrimSpace(fmt.Sprintf("%s action #%d else", base.Direction, i+1))
+		issues = append(issues, validateActions(action.Else, driverList, elseList)...)
+	}
+	return issues
+}
+
+// validateAction checks that the driver for an action exists, and that the action makes sense for the driver.
+// An empty message is returned if there is nothing wrong with the action.
+func validateAction(action Action, driverList []drivers.DriverInterface) (Severity, string) {
+	// The actions in a scene are checked with the scene, and barriers don't use a driver.
+	if action.Scene != "" || action.Barrier || action.Sleep != nil || action.HTTP != nil || action.Shell != nil {
+		return "", ""
+	}
+	if action.WaitFor != nil {
+		return validateWaitFor(action.WaitFor, driverList)
+	}
+
+	var driver drivers.DriverInterface
+	for _, d := range driverList {
+		if d.GetShortName() == action.DriverName {
+			driver = d
+		}
+	}
+	if driver == nil {
+		return SeverityError, fmt.Sprintf("driver [%s] has not been configured", action.DriverName)
+	}
+
+	switch driver.(type) {
+	case drivers.OutputSingle, drivers.OutputMatrix:
+	default:
+		return SeverityError, fmt.Sprintf("[%s] can not switch inputs or outputs", action.DriverName)
+	}
+
+	routes, err := action.routes(driver)
+	if err != nil {
+		return SeverityError, err.Error()
+	}
+	if action.Layer != "" {
+		if layered, ok := driver.(drivers.LayeredOutput); !ok || !contains(layered.Layers(), action.Layer) {
+			return SeverityError, fmt.Sprintf("[%s] can not switch the %s layer on its own", action.DriverName, action.Layer)
+		}
+	}
+
+	ports, canList := driver.(drivers.PortLister)
+	if !canList {
+		if _, isMatrix := driver.(drivers.OutputMatrix); isMatrix {
+			return SeverityWarning, fmt.Sprintf("the inputs and outputs for [%s] can not be checked", action.DriverName)
+		}
+		return SeverityWarning, fmt.Sprintf("the inputs for [%s] can not be checked", action.DriverName)
+	}
+	for _, route := range routes {
+		if route.Output != "" && !contains(ports.OutputNames(), route.Output) {
+			return SeverityError, fmt.Sprintf("[%s] does not have an output named [%s] (outputs: %s)", action.DriverName, route.Output, strings.Join(ports.OutputNames(), ", "))
+		}
+		if !contains(ports.InputNames(), route.Input) {
+			return SeverityError, fmt.Sprintf("[%s] does not have an input named [%s] (inputs: %s)", action.DriverName, route.Input, strings.Join(ports.InputNames(), ", "))
+		}
+	}
+
+	return "", ""
+}
+
+// validateWaitFor checks that the driver for a wait_for action can tell us about the input.
+func validateWaitFor(wait *WaitForAction, driverList []drivers.DriverInterface) (Severity, string) {
+	var driver drivers.DriverInterface
+	for _, d := range driverList {
+		if d.GetShortName() == wait.DriverName {
+			driver = d
+		}
+	}
+	if driver == nil {
+		return SeverityError, fmt.Sprintf("driver [%s] has not been configured", wait.DriverName)
+	}
+	if _, ok := driver.(drivers.InputStatus); !ok {
+		return SeverityError, fmt.Sprintf("[%s] can not tell if an input is active", wait.DriverName)
+	}
+	if ports, ok := driver.(drivers.PortLister); ok && !contains(ports.InputNames(), drivers.AliasesOf(driver).InputPort(wait.Input)) {
+		return SeverityError, fmt.Sprintf("[%s] does not have an input named [%s] (inputs: %s)", wait.DriverName, wait.Input, strings.Join(ports.InputNames(), ", "))
+	}
+	return "", ""
+}
+
+// contains checks if s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/timgws/kvm-switch/server/drivers"
+	"github.com/timgws/kvm-switch/server/drivers/blustream"
+	"github.com/timgws/kvm-switch/server/drivers/startech_kvm"
+)
+
+func TestValidateBuiltInLayout(t *testing.T) {
+	driverList := []drivers.DriverInterface{
+		startech_kvm.NewInstance(drivers.Config{}),
+		blustream.NewInstance(drivers.Config{}),
+	}
+
+	issues := BuildLayout().Validate(driverList)
+	if issues.HasErrors() {
+		t.Fatalf("The built-in layout should be valid:\n%s", issues)
+	}
+}
+
+func TestValidateFindsBadActions(t *testing.T) {
+	driverList := []drivers.DriverInterface{
+		startech_kvm.NewInstance(drivers.Config{}),
+		blustream.NewInstance(drivers.Config{}),
+	}
+
+	layout := &Layout{
+		Computers: []Computer{{
+			Name: "pc1",
+			Directions: Directions{
+				Left: []Action{
+					{DriverName: "extron", PerformAction: "1"},
+					{DriverName: "matrix", PerformAction: "0103"},
+					{DriverName: "matrix", PerformAction: "01-09"},
+					{DriverName: "kvm", PerformAction: "5"},
+					{DriverName: "kvm", PerformAction: "01-02"},
+					{DriverName: "kvm", PerformAction: "4"},
+					{DriverName: "matrix", Input: "03", Output: "01", Layer: "audio"},
+				},
+			},
+		}, {
+			Name: "pc2",
+		}},
+	}
+
+	expected := []string{
+		"driver [extron] has not been configured",
+		"expected <output>-<input> but got [0103]",
+		"does not have an input named [09]",
+		"does not have an input named [5]",
+		"only has one output",
+		"can not switch the audio layer on its own",
+	}
+
+	issues := layout.Validate(driverList)
+	errs := issues.Errors()
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got:\n%s", len(expected), issues)
+	}
+	for i, message := range expected {
+		if !strings.Contains(errs[i].Message, message) {
+			t.Errorf("Expected error %d to contain %q, got %q", i, message, errs[i].Message)
+		}
+	}
+
+	if errs[0].Action != 1 || !strings.Contains(errs[0].String(), "left action #1:") {
+		t.Errorf("Expected actions to be numbered from 1, got %d (%s)", errs[0].Action, errs[0])
+	}
+
+	if len(issues) != len(errs)+1 || issues[len(issues)-1].Computer != "pc2" {
+		t.Errorf("Expected a warning for pc2, which has no actions:\n%s", issues)
+	}
+	if warning, _ := json.Marshal(issues[len(issues)-1]); strings.Contains(string(warning), `"action"`) {
+		t.Errorf("Expected the warning for pc2 to not have an action, got %s", warning)
+	}
+}
+
+func TestValidateFindsOverlappingSegments(t *testing.T) {
+	kvm := []Action{{DriverName: "kvm", PerformAction: "1"}}
+	layout := &Layout{
+		Computers: []Computer{{
+			Name: "portrait",
+			Directions: Directions{
+				Segments: []EdgeSegment{
+					{Edge: "right", From: 0, To: 0.5, Actions: kvm},
+					{Edge: "right", From: 0.5, To: 1, Actions: kvm},
+					{Edge: "left", From: 0.4, To: 1, Actions: kvm},
+					{Edge: "left", From: 0, To: 0.6, Actions: kvm},
+				},
+			},
+		}},
+	}
+
+	errs := layout.Validate([]drivers.DriverInterface{startech_kvm.NewInstance(drivers.Config{})}).Errors()
+	if len(errs) != 1 || errs[0].Message != "the left segments 0.40-1.00 and 0.00-0.60 overlap" {
+		t.Errorf("Expected just the left segments to overlap, got:\n%s", errs)
+	}
+}